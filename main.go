@@ -1,16 +1,29 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
+	"os"
 
 	"github.com/AriJaya07/go-rest-api/packages/config"
 	"github.com/AriJaya07/go-rest-api/packages/config/db"
+	"github.com/AriJaya07/go-rest-api/packages/logging"
+	"github.com/AriJaya07/go-rest-api/packages/metrics"
 	"github.com/AriJaya07/go-rest-api/packages/models/store"
 	api "github.com/AriJaya07/go-rest-api/packages/routes"
+	"github.com/AriJaya07/go-rest-api/packages/tracing"
 	"github.com/go-sql-driver/mysql"
 )
 
 func main() {
+	logging.Init()
+
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		slog.Error("failed to initialize tracing", slog.Any("error", err))
+		os.Exit(1)
+	}
+
 	cfg := mysql.Config{
 		User:                 config.Envs.DBUser,
 		Passwd:               config.Envs.DBPassword,
@@ -21,15 +34,30 @@ func main() {
 		ParseTime:            true,
 	}
 
-	sqlStorage := db.NewMySQLStorage(cfg)
+	sqlStorage, err := db.NewMySQLStorage(cfg)
+	if err != nil {
+		slog.Error("failed to connect to MySQL", slog.Any("error", err))
+		os.Exit(1)
+	}
 
-	db, err := sqlStorage.Init()
+	conn, err := sqlStorage.Init()
 	if err != nil {
-		log.Fatal(err)
+		slog.Error("failed to initialize database", slog.Any("error", err))
+		os.Exit(1)
 	}
 
-	store := store.NewStore(db)
+	metrics.RegisterDB(conn, config.Envs.DBName)
 
-	server := api.NewAPIServer(":3000", store)
-	server.Serve()
+	store := store.NewInstrumentedStore(store.NewStore(conn))
+
+	server := api.NewAPIServer(":"+config.Envs.Port, store, db.LatestMigration())
+	err = server.Serve()
+
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Error("failed to flush traces", slog.Any("error", err))
+	}
+	if err != nil {
+		slog.Error("server stopped", slog.Any("error", err))
+		os.Exit(1)
+	}
 }
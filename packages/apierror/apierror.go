@@ -0,0 +1,188 @@
+// Package apierror defines the errors handlers and the store return and
+// writes them as RFC 7807 application/problem+json responses.
+package apierror
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Kind classifies an error and decides its HTTP status.
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindBadRequest
+	KindValidation
+	KindUnauthorized
+	KindForbidden
+	KindNotFound
+	KindNotAcceptable
+	KindConflict
+	KindPreconditionFailed
+	KindUnsupportedMediaType
+	KindPayloadTooLarge
+	KindTooManyRequests
+	KindBadGateway
+)
+
+var kindStatus = map[Kind]int{
+	KindInternal:             http.StatusInternalServerError,
+	KindBadRequest:           http.StatusBadRequest,
+	KindValidation:           http.StatusUnprocessableEntity,
+	KindUnauthorized:         http.StatusUnauthorized,
+	KindForbidden:            http.StatusForbidden,
+	KindNotFound:             http.StatusNotFound,
+	KindNotAcceptable:        http.StatusNotAcceptable,
+	KindConflict:             http.StatusConflict,
+	KindPreconditionFailed:   http.StatusPreconditionFailed,
+	KindUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	KindPayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	KindTooManyRequests:      http.StatusTooManyRequests,
+	KindBadGateway:           http.StatusBadGateway,
+}
+
+// Stable codes for errors that have no more specific one. Clients may rely
+// on codes; details are for humans and may change.
+const (
+	CodeInternal             = "internal_error"
+	CodeBadRequest           = "bad_request"
+	CodeValidation           = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeNotAcceptable        = "not_acceptable"
+	CodeConflict             = "conflict"
+	CodeInUse                = "resource_in_use"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodePayloadTooLarge      = "payload_too_large"
+	CodeTooManyRequests      = "rate_limited"
+	CodeBadGateway           = "bad_gateway"
+)
+
+const (
+	// mysqlDuplicateEntry is ER_DUP_ENTRY, raised when a unique key is
+	// violated.
+	mysqlDuplicateEntry = 1062
+	// mysqlRowIsReferenced is ER_ROW_IS_REFERENCED_2, raised when deleting
+	// a row that a foreign key still points at.
+	mysqlRowIsReferenced = 1451
+)
+
+type Error struct {
+	Kind   Kind
+	Code   string
+	Detail string
+	// Fields maps request fields to what is wrong with them.
+	Fields map[string][]string
+	// Err is the underlying cause. It is logged but never sent to clients.
+	Err error
+}
+
+func New(kind Kind, code, detail string) *Error {
+	return &Error{Kind: kind, Code: code, Detail: detail}
+}
+
+func BadRequest(code, detail string) *Error {
+	return New(KindBadRequest, code, detail)
+}
+
+// Validation reports a well-formed request whose fields are not acceptable.
+func Validation(detail string, fields map[string][]string) *Error {
+	return &Error{Kind: KindValidation, Code: CodeValidation, Detail: detail, Fields: fields}
+}
+
+func Unauthorized(code, detail string) *Error {
+	return New(KindUnauthorized, code, detail)
+}
+
+func Forbidden(code, detail string) *Error {
+	return New(KindForbidden, code, detail)
+}
+
+func NotFound(code, detail string) *Error {
+	return New(KindNotFound, code, detail)
+}
+
+func Conflict(code, detail string) *Error {
+	return New(KindConflict, code, detail)
+}
+
+// PreconditionFailed reports that the resource is no longer in the state
+// the client last saw.
+func PreconditionFailed(detail string) *Error {
+	return New(KindPreconditionFailed, CodePreconditionFailed, detail)
+}
+
+// Internal hides err from the client behind a generic 500.
+func Internal(err error) *Error {
+	return &Error{Kind: KindInternal, Code: CodeInternal, Detail: "Internal server error", Err: err}
+}
+
+// Wrap records err as the cause and returns e.
+func (e *Error) Wrap(err error) *Error {
+	e.Err = err
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Detail + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Status() int {
+	return kindStatus[e.Kind]
+}
+
+// From returns err as an *Error. Missing rows become 404, and duplicate keys
+// and rows still referenced by a foreign key 409; anything else
+// unrecognised is an internal error.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound(CodeNotFound, "Resource not found").Wrap(err)
+	}
+	if IsDuplicateKey(err) {
+		return Conflict(CodeConflict, "Resource already exists").Wrap(err)
+	}
+	if IsReferenced(err) {
+		return Conflict(CodeInUse, "Resource is still in use").Wrap(err)
+	}
+
+	return Internal(err)
+}
+
+// KindOf reports the kind of err, treating unrecognised errors as internal.
+func KindOf(err error) Kind {
+	if err == nil {
+		return KindInternal
+	}
+	return From(err).Kind
+}
+
+// IsDuplicateKey reports whether err is a MySQL unique key violation.
+func IsDuplicateKey(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == mysqlDuplicateEntry
+}
+
+// IsReferenced reports whether err is a MySQL foreign key violation from
+// deleting a row that other rows still refer to.
+func IsReferenced(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == mysqlRowIsReferenced
+}
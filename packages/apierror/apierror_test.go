@@ -0,0 +1,70 @@
+package apierror
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestFromMapsStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"no rows", sql.ErrNoRows, http.StatusNotFound, CodeNotFound},
+		{"wrapped no rows", fmt.Errorf("get project: %w", sql.ErrNoRows), http.StatusNotFound, CodeNotFound},
+		{"duplicate key", &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, http.StatusConflict, CodeConflict},
+		{"row still referenced", &mysql.MySQLError{Number: 1451, Message: "Cannot delete or update a parent row"}, http.StatusConflict, CodeInUse},
+		{"wrapped row still referenced", fmt.Errorf("delete project: %w", &mysql.MySQLError{Number: 1451}), http.StatusConflict, CodeInUse},
+		{"other mysql error", &mysql.MySQLError{Number: 1146, Message: "Table doesn't exist"}, http.StatusInternalServerError, CodeInternal},
+		{"typed", NotFound("project_not_found", "Project not found").Wrap(sql.ErrNoRows), http.StatusNotFound, "project_not_found"},
+		{"validation", Validation("bad", nil), http.StatusUnprocessableEntity, CodeValidation},
+		{"unknown", errors.New("boom"), http.StatusInternalServerError, CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := From(tt.err)
+			if e.Status() != tt.status || e.Code != tt.code {
+				t.Errorf("got %d %q, want %d %q", e.Status(), e.Code, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("X-Request-ID", "req-1")
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/tasks/$7", nil)
+
+	Write(rec, r, errors.New("connection refused"))
+
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	want := Problem{
+		Type:      "about:blank",
+		Title:     "Internal Server Error",
+		Status:    http.StatusInternalServerError,
+		Detail:    "Internal server error",
+		Instance:  "/api/v1/tasks/$7",
+		Code:      CodeInternal,
+		RequestID: "req-1",
+	}
+	if fmt.Sprint(p) != fmt.Sprint(want) {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+}
@@ -0,0 +1,51 @@
+package apierror
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/AriJaya07/go-rest-api/packages/logging"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem is the RFC 7807 body. Code, Fields and RequestID are extension
+// members.
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Instance  string              `json:"instance,omitempty"`
+	Code      string              `json:"code"`
+	Fields    map[string][]string `json:"fields,omitempty"`
+	RequestID string              `json:"requestId,omitempty"`
+}
+
+// Write sends err as a problem+json response. Internal errors are logged
+// with their cause; clients only see a generic detail.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	e := From(err)
+	status := e.Status()
+
+	if e.Kind == KindInternal && e.Err != nil {
+		logging.FromContext(r.Context()).Error("request failed", slog.Any("error", e.Err))
+	}
+
+	problem := Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   e.Detail,
+		Instance: r.URL.Path,
+		Code:     e.Code,
+		Fields:   e.Fields,
+		// set by the RequestID middleware before the handler runs
+		RequestID: w.Header().Get("X-Request-ID"),
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(problem)
+}
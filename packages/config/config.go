@@ -3,6 +3,9 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -12,6 +15,83 @@ type Config struct {
 	DBAddress  string
 	DBName     string
 	JWTSecret  string
+	TOTPIssuer string
+	// Session cookies
+	CookieSecure   bool
+	CookieSameSite string
+	// OpenID Connect login; disabled when OIDCIssuer is empty
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+	// Password login providers, tried in order
+	AuthProviders    []string
+	LDAPURL          string
+	LDAPBindDN       string
+	LDAPBindPassword string
+	LDAPBaseDN       string
+	LDAPUserFilter   string
+	LDAPStartTLS     bool
+	LDAPGroupRoles   map[string]string
+	LDAPTimeout      time.Duration
+	// Password hashing
+	PasswordHashAlgorithm string
+	Argon2Memory          int
+	Argon2Time            int
+	Argon2Threads         int
+	BcryptCost            int
+	// Password policy
+	PasswordMinLength     int
+	PasswordMaxBytes      int
+	PasswordRequireUpper  bool
+	PasswordRequireLower  bool
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+	// HTTP server
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	ShutdownDelay     time.Duration
+	MaxHeaderBytes    int
+	MaxBodyBytes      int64
+	// Logging
+	LogFormat string
+	LogLevel  string
+	// Tracing
+	ServiceName         string
+	TracingExporter     string
+	TracingOTLPEndpoint string
+	TracingOTLPInsecure bool
+	TracingSampleRatio  float64
+	// Rate limiting, as "<requests>/<period>"
+	RateLimitEnabled bool
+	RateLimitDefault string
+	RateLimitAuth    string
+	TrustedProxies   []string
+	// CORS and security headers
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+	HSTSMaxAge           time.Duration
+	// Response compression
+	CompressionEnabled bool
+	CompressionMinSize int
+	// OpenAPI validation
+	OpenAPIValidateRequests  bool
+	OpenAPIValidateResponses bool
+	// List pagination
+	PageSizeDefault int
+	PageSizeMax     int
+	// API versions. The v1 dates are sent on v1 routes that have a v2
+	// successor; a zero sunset is not announced.
+	APIDefaultVersion string
+	APIV1DeprecatedAt time.Time
+	APIV1Sunset       time.Time
 }
 
 var Envs = initConfig()
@@ -24,6 +104,82 @@ func initConfig() Config {
 		DBAddress:  fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.0.1"), getEnv("DB_PORT", "3306")),
 		DBName:     getEnv("DB_NAME", "go_test"),
 		JWTSecret:  getEnv("JWT_SECRET", "randomjwtsecretkey"),
+		TOTPIssuer: getEnv("TOTP_ISSUER", "go-rest-api"),
+
+		CookieSecure:   getEnvBool("COOKIE_SECURE", true),
+		CookieSameSite: getEnv("COOKIE_SAME_SITE", "lax"),
+
+		OIDCIssuer:       getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/users/oidc/callback"),
+		OIDCScopes:       getEnvList("OIDC_SCOPES", []string{"openid", "email", "profile"}),
+
+		AuthProviders:    getEnvList("AUTH_PROVIDERS", []string{"local"}),
+		LDAPURL:          getEnv("LDAP_URL", "ldap://127.0.0.1:389"),
+		LDAPBindDN:       getEnv("LDAP_BIND_DN", ""),
+		LDAPBindPassword: getEnv("LDAP_BIND_PASSWORD", ""),
+		LDAPBaseDN:       getEnv("LDAP_BASE_DN", ""),
+		LDAPUserFilter:   getEnv("LDAP_USER_FILTER", "(mail=%s)"),
+		LDAPStartTLS:     getEnvBool("LDAP_START_TLS", false),
+		LDAPGroupRoles:   getEnvGroupRoles("LDAP_GROUP_ROLES"),
+		LDAPTimeout:      getEnvDuration("LDAP_TIMEOUT", 5*time.Second),
+
+		PasswordHashAlgorithm: getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		Argon2Memory:          getEnvInt("ARGON2_MEMORY", 64*1024),
+		Argon2Time:            getEnvInt("ARGON2_TIME", 3),
+		Argon2Threads:         getEnvInt("ARGON2_THREADS", 2),
+		BcryptCost:            getEnvInt("BCRYPT_COST", 10),
+
+		PasswordMinLength:     getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		PasswordMaxBytes:      getEnvInt("PASSWORD_MAX_BYTES", 72),
+		PasswordRequireUpper:  getEnvBool("PASSWORD_REQUIRE_UPPER", true),
+		PasswordRequireLower:  getEnvBool("PASSWORD_REQUIRE_LOWER", true),
+		PasswordRequireDigit:  getEnvBool("PASSWORD_REQUIRE_DIGIT", true),
+		PasswordRequireSymbol: getEnvBool("PASSWORD_REQUIRE_SYMBOL", false),
+
+		ReadTimeout:       getEnvDuration("HTTP_READ_TIMEOUT", 15*time.Second),
+		ReadHeaderTimeout: getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:      getEnvDuration("HTTP_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       getEnvDuration("HTTP_IDLE_TIMEOUT", 120*time.Second),
+		ShutdownTimeout:   getEnvDuration("HTTP_SHUTDOWN_TIMEOUT", 20*time.Second),
+		ShutdownDelay:     getEnvDuration("HTTP_SHUTDOWN_DELAY", 5*time.Second),
+		MaxHeaderBytes:    getEnvInt("HTTP_MAX_HEADER_BYTES", 1<<20),
+		MaxBodyBytes:      int64(getEnvInt("HTTP_MAX_BODY_BYTES", 1<<20)),
+
+		LogFormat: getEnv("LOG_FORMAT", "json"),
+		LogLevel:  getEnv("LOG_LEVEL", "info"),
+
+		ServiceName:         getEnv("SERVICE_NAME", "go-rest-api"),
+		TracingExporter:     getEnv("TRACING_EXPORTER", "none"),
+		TracingOTLPEndpoint: getEnv("TRACING_OTLP_ENDPOINT", "localhost:4318"),
+		TracingOTLPInsecure: getEnvBool("TRACING_OTLP_INSECURE", true),
+		TracingSampleRatio:  getEnvFloat("TRACING_SAMPLE_RATIO", 1),
+
+		RateLimitEnabled: getEnvBool("RATE_LIMIT_ENABLED", true),
+		RateLimitDefault: getEnv("RATE_LIMIT_DEFAULT", "100/1m"),
+		RateLimitAuth:    getEnv("RATE_LIMIT_AUTH", "10/1m"),
+		TrustedProxies:   getEnvList("TRUSTED_PROXIES", nil),
+
+		CORSAllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS", nil),
+		CORSAllowedMethods:   getEnvList("CORS_ALLOWED_METHODS", []string{"GET", "POST", "PUT", "PATCH", "DELETE"}),
+		CORSAllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS", []string{"Authorization", "Content-Type", "X-Request-ID", "X-CSRF-Token", "If-Match", "If-None-Match"}),
+		CORSAllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", true),
+		CORSMaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+		HSTSMaxAge:           getEnvDuration("HSTS_MAX_AGE", 365*24*time.Hour),
+
+		CompressionEnabled: getEnvBool("COMPRESSION_ENABLED", true),
+		CompressionMinSize: getEnvInt("COMPRESSION_MIN_SIZE", 1024),
+
+		OpenAPIValidateRequests:  getEnvBool("OPENAPI_VALIDATE_REQUESTS", true),
+		OpenAPIValidateResponses: getEnvBool("OPENAPI_VALIDATE_RESPONSES", false),
+
+		PageSizeDefault: getEnvInt("PAGE_SIZE_DEFAULT", 20),
+		PageSizeMax:     getEnvInt("PAGE_SIZE_MAX", 100),
+
+		APIDefaultVersion: getEnv("API_DEFAULT_VERSION", "v2"),
+		APIV1DeprecatedAt: getEnvDate("API_V1_DEPRECATED_AT", time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)),
+		APIV1Sunset:       getEnvDate("API_V1_SUNSET", time.Time{}),
 	}
 }
 
@@ -34,3 +190,88 @@ func getEnv(key, fallback string) string {
 
 	return fallback
 }
+
+// getEnvList reads a comma separated list, ignoring empty entries.
+func getEnvList(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	var list []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
+
+func getEnvInt(key string, fallback int) int {
+	if value, ok := os.LookupEnv(key); ok {
+		if i, err := strconv.Atoi(value); err == nil {
+			return i
+		}
+	}
+
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if value, ok := os.LookupEnv(key); ok {
+		if f, err := strconv.ParseFloat(value, 64); err == nil {
+			return f
+		}
+	}
+
+	return fallback
+}
+
+// getEnvDuration accepts Go duration strings such as "15s" or "2m".
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+
+	return fallback
+}
+
+// getEnvDate parses a YYYY-MM-DD date, taken as midnight UTC.
+func getEnvDate(key string, fallback time.Time) time.Time {
+	if value, ok := os.LookupEnv(key); ok {
+		if t, err := time.Parse(time.DateOnly, value); err == nil {
+			return t
+		}
+	}
+
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+
+	return fallback
+}
+
+// getEnvGroupRoles parses "groupDN=role" pairs separated by semicolons. Group
+// DNs contain '=' themselves, so the role is taken after the last one.
+func getEnvGroupRoles(key string) map[string]string {
+	roles := map[string]string{}
+
+	for _, pair := range strings.Split(os.Getenv(key), ";") {
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 {
+			continue
+		}
+		roles[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+
+	return roles
+}
@@ -2,8 +2,7 @@ package db
 
 import (
 	"database/sql"
-	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/go-sql-driver/mysql"
 )
@@ -12,20 +11,21 @@ type MySQLStorage struct {
 	db *sql.DB
 }
 
-func NewMySQLStorage(cfg mysql.Config) *MySQLStorage {
+func NewMySQLStorage(cfg mysql.Config) (*MySQLStorage, error) {
 	db, err := sql.Open("mysql", cfg.FormatDSN())
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	err = db.Ping()
 	if err != nil {
-		log.Fatal(err)
+		db.Close()
+		return nil, err
 	}
 
-	fmt.Println("Connected to MySQL!")
+	slog.Info("connected to MySQL", slog.String("addr", cfg.Addr), slog.String("db", cfg.DBName))
 
-	return &MySQLStorage{db: db}
+	return &MySQLStorage{db: db}, nil
 }
 
 func (s *MySQLStorage) Init() (*sql.DB, error) {
@@ -39,6 +39,9 @@ func (s *MySQLStorage) Init() (*sql.DB, error) {
 	if err := s.createTasksTable(); err != nil {
 		return nil, err
 	}
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
 
 	return s.db, nil
 }
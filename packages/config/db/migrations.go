@@ -0,0 +1,140 @@
+package db
+
+import "fmt"
+
+type migration struct {
+	version int
+	name    string
+	stmts   []string
+}
+
+// migrations holds every schema change made after the base tables above.
+// Entries are applied in order and recorded in schema_migrations, so they
+// must never be edited or reordered once released; append a new one instead.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "add users.role",
+		stmts: []string{
+			`ALTER TABLE users ADD COLUMN role VARCHAR(32) NOT NULL DEFAULT 'user'`,
+		},
+	},
+	{
+		version: 2,
+		name:    "create two-factor tables",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS user_totp (
+				userId INT UNSIGNED NOT NULL,
+				secret VARCHAR(64) NOT NULL,
+				confirmed BOOLEAN NOT NULL DEFAULT FALSE,
+				lastUsedStep BIGINT NOT NULL DEFAULT 0,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (userId),
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8`,
+			`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				userId INT UNSIGNED NOT NULL,
+				codeHash CHAR(64) NOT NULL,
+				usedAt TIMESTAMP NULL DEFAULT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				UNIQUE KEY (userId, codeHash),
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8`,
+		},
+	},
+	{
+		version: 3,
+		name:    "create user_identities",
+		stmts: []string{
+			`CREATE TABLE IF NOT EXISTS user_identities (
+				id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+				userId INT UNSIGNED NOT NULL,
+				issuer VARCHAR(255) NOT NULL,
+				subject VARCHAR(255) NOT NULL,
+				createdAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+				PRIMARY KEY (id),
+				UNIQUE KEY (issuer, subject),
+				FOREIGN KEY (userId) REFERENCES users(id) ON DELETE CASCADE
+			) ENGINE=InnoDB DEFAULT CHARSET=utf8`,
+		},
+	},
+	{
+		version: 4,
+		name:    "add version and updatedAt columns",
+		stmts: []string{
+			`ALTER TABLE users
+				ADD COLUMN version INT UNSIGNED NOT NULL DEFAULT 1,
+				ADD COLUMN updatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP`,
+			`ALTER TABLE projects
+				ADD COLUMN version INT UNSIGNED NOT NULL DEFAULT 1,
+				ADD COLUMN updatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP`,
+			`ALTER TABLE tasks
+				ADD COLUMN version INT UNSIGNED NOT NULL DEFAULT 1,
+				ADD COLUMN updatedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP`,
+			`UPDATE users SET updatedAt = createdAt`,
+			`UPDATE projects SET updatedAt = createdAt`,
+			`UPDATE tasks SET updatedAt = createdAt`,
+		},
+	},
+}
+
+// LatestMigration is the schema version this binary expects.
+func LatestMigration() int {
+	return migrations[len(migrations)-1].version
+}
+
+func (s *MySQLStorage) migrate() error {
+	_, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INT UNSIGNED NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			appliedAt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+			PRIMARY KEY (version)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+	`)
+	if err != nil {
+		return err
+	}
+
+	applied := map[int]bool{}
+	rows, err := s.db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			return err
+		}
+		applied[v] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.version] {
+			continue
+		}
+
+		for _, stmt := range m.stmts {
+			if _, err := s.db.Exec(stmt); err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+			}
+		}
+
+		if _, err := s.db.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
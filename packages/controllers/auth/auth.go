@@ -1,53 +1,141 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt"
-	"golang.org/x/crypto/bcrypt"
-
-	"github.com/AriJaya07/go-rest-api/packages/utils"
+	"github.com/gorilla/mux"
 
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
 	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/logging"
+	"github.com/AriJaya07/go-rest-api/packages/middleware"
 	"github.com/AriJaya07/go-rest-api/packages/models/store"
 	"github.com/AriJaya07/go-rest-api/packages/models/types"
 )
 
+const challengePurpose = "2fa"
+
+var errInvalidChallenge = errors.New("invalid or expired login challenge")
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
 func WithJWTAuth(handlerFunc http.HandlerFunc, store store.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// get the token from the request (Auth header)
-		tokenString := GetTokenFromRequest(r)
+		logger := logging.FromContext(r.Context())
+
+		// get the token from the request (Auth header, query or cookie)
+		tokenString, fromCookie := tokenFromRequest(r)
 		// validate the token
 		token, err := validateJWT(tokenString)
 		if err != nil {
-			log.Println("failed to authentication token")
-			permissionDenied(w)
+			logger.Info("failed to authenticate token", slog.Any("error", err))
+			permissionDenied(w, r)
 			return
 		}
 
 		if !token.Valid {
-			log.Println("failed to authentication token")
-			permissionDenied(w)
+			logger.Info("failed to authenticate token", slog.String("reason", "invalid token"))
+			permissionDenied(w, r)
 			return
 		}
 		// get the userId from the token
-		claims := token.Claims.(jwt.MapClaims)
-		userID := claims["userID"].(string)
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok || claims["purpose"] != nil {
+			logger.Info("failed to authenticate token", slog.String("reason", "unexpected claims"))
+			permissionDenied(w, r)
+			return
+		}
 
-		_, err = store.GetUserByID(userID)
+		userID, ok := claims["userID"].(string)
+		if !ok {
+			logger.Info("failed to authenticate token", slog.String("reason", "missing user id"))
+			permissionDenied(w, r)
+			return
+		}
+
+		// browsers attach cookies to cross-site requests, so cookie
+		// sessions must prove the request came from our frontend
+		if fromCookie && requiresCSRF(r) && !validCSRF(r, tokenString) {
+			logger.Info("rejected request without valid CSRF token")
+			apierror.Write(w, r, apierror.Forbidden("invalid_csrf_token", "invalid CSRF token"))
+			return
+		}
+
+		user, err := store.GetUserByID(r.Context(), userID)
 		if err != nil {
-			log.Println("failed to get user")
-			permissionDenied(w)
+			logger.Info("failed to get user", slog.String("user_id", userID), slog.Any("error", err))
+			permissionDenied(w, r)
 			return
 		}
 
+		middleware.SetUserID(r.Context(), user.ID)
+
 		// call the handler func and continue to the endpoint
-		handlerFunc(w, r)
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		ctx = logging.WithAttrs(ctx, slog.Int64("user_id", user.ID))
+		handlerFunc(w, r.WithContext(ctx))
+	}
+}
+
+// TokenUserID returns the user ID of a valid session token on the request
+// without loading the user, for callers such as the rate limiter that run
+// before authentication.
+func TokenUserID(r *http.Request) (string, bool) {
+	token, err := validateJWT(GetTokenFromRequest(r))
+	if err != nil || !token.Valid {
+		return "", false
 	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != nil {
+		return "", false
+	}
+
+	userID, ok := claims["userID"].(string)
+	return userID, ok
+}
+
+// WithAdminAuth behaves like WithJWTAuth but additionally requires the
+// authenticated user to have the admin role.
+func WithAdminAuth(handlerFunc http.HandlerFunc, store store.Store) http.HandlerFunc {
+	return WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok || user.Role != types.RoleAdmin {
+			apierror.Write(w, r, apierror.Forbidden(apierror.CodeForbidden, "forbidden"))
+			return
+		}
+
+		handlerFunc(w, r)
+	}, store)
+}
+
+// WithOwnerAuth only lets through the user named by the {id} route
+// variable, and admins.
+func WithOwnerAuth(handlerFunc http.HandlerFunc, store store.Store) http.HandlerFunc {
+	return WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := UserFromContext(r.Context())
+		if !ok || (strconv.FormatInt(user.ID, 10) != mux.Vars(r)["id"] && user.Role != types.RoleAdmin) {
+			apierror.Write(w, r, apierror.Forbidden(apierror.CodeForbidden, "forbidden"))
+			return
+		}
+
+		handlerFunc(w, r)
+	}, store)
+}
+
+// UserFromContext returns the user authenticated by WithJWTAuth.
+func UserFromContext(ctx context.Context) (*types.User, bool) {
+	user, ok := ctx.Value(userContextKey).(*types.User)
+	return user, ok
 }
 
 func CreateJWT(secret []byte, userID int64, email string) (string, error) {
@@ -65,13 +153,46 @@ func CreateJWT(secret []byte, userID int64, email string) (string, error) {
 	return tokenString, nil
 }
 
-func HashPassword(pw string) (string, error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
+// CreateLoginChallenge issues a short-lived token proving that the password
+// step of a two-factor login succeeded. It is rejected by WithJWTAuth.
+func CreateLoginChallenge(secret []byte, userID int64) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"challengeUserID": strconv.Itoa(int(userID)),
+		"purpose":         challengePurpose,
+		"exp":             time.Now().Add(5 * time.Minute).Unix(),
+	})
+
+	return token.SignedString(secret)
+}
+
+// ParseLoginChallenge validates a token from CreateLoginChallenge and returns
+// the user ID it was issued for.
+func ParseLoginChallenge(t string) (int64, error) {
+	token, err := validateJWT(t)
+	if err != nil || !token.Valid {
+		return 0, errInvalidChallenge
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != challengePurpose {
+		return 0, errInvalidChallenge
+	}
+
+	idStr, ok := claims["challengeUserID"].(string)
+	if !ok {
+		return 0, errInvalidChallenge
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		return "", err
+		return 0, errInvalidChallenge
 	}
 
-	return string(hash), nil
+	return id, nil
+}
+
+func HashPassword(pw string) (string, error) {
+	return defaultHasher.Hash(pw)
 }
 
 func validateJWT(t string) (*jwt.Token, error) {
@@ -86,23 +207,32 @@ func validateJWT(t string) (*jwt.Token, error) {
 	})
 }
 
-func permissionDenied(w http.ResponseWriter) {
-	utils.WriteJSON(w, http.StatusUnauthorized, types.ErrorResponse{
-		Error: fmt.Errorf("permission denied").Error(),
-	})
+func permissionDenied(w http.ResponseWriter, r *http.Request) {
+	apierror.Write(w, r, apierror.Unauthorized(apierror.CodeUnauthorized, "permission denied"))
 }
 
 func GetTokenFromRequest(r *http.Request) string {
+	token, _ := tokenFromRequest(r)
+	return token
+}
+
+// tokenFromRequest also reports whether the token came from the session
+// cookie, which is the only source a browser sends automatically.
+func tokenFromRequest(r *http.Request) (string, bool) {
 	tokenAuth := r.Header.Get("Authorization")
 	tokenQuery := r.URL.Query().Get("token")
 
 	if tokenAuth != "" {
-		return tokenAuth
+		return tokenAuth, false
 	}
 
 	if tokenQuery != "" {
-		return tokenQuery
+		return tokenQuery, false
+	}
+
+	if cookie, err := r.Cookie(SessionCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, true
 	}
 
-	return ""
+	return "", false
 }
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/logging"
+	"github.com/AriJaya07/go-rest-api/packages/models/store"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+// ErrInvalidCredentials is returned by an Authenticator that does not accept
+// the given username and password. A chain moves on to the next
+// authenticator when it sees this error.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+// Authenticator checks a username and password and returns the local user
+// they belong to.
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*types.User, error)
+}
+
+// Chain tries each authenticator in order and returns the first success.
+// When none succeeds, a rejection wins over a provider failure, so a wrong
+// password is reported as such while another provider is down.
+type Chain []Authenticator
+
+func (c Chain) Name() string {
+	names := make([]string, len(c))
+	for i, a := range c {
+		names[i] = a.Name()
+	}
+
+	return strings.Join(names, ",")
+}
+
+func (c Chain) Authenticate(ctx context.Context, username, password string) (*types.User, error) {
+	var (
+		rejected bool
+		failure  error
+	)
+
+	for _, a := range c {
+		user, err := a.Authenticate(ctx, username, password)
+		if err == nil {
+			return user, nil
+		}
+		if errors.Is(err, ErrInvalidCredentials) {
+			rejected = true
+			continue
+		}
+		// keep trying the remaining providers, but report the failure if
+		// none of them could give an answer
+		logging.FromContext(ctx).Warn("authenticator failed", slog.String("authenticator", a.Name()), slog.Any("error", err))
+		failure = err
+	}
+
+	if rejected || failure == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return nil, failure
+}
+
+// NewAuthenticator builds the chain configured by AUTH_PROVIDERS.
+func NewAuthenticator(s store.Store) Authenticator {
+	var chain Chain
+
+	for _, name := range config.Envs.AuthProviders {
+		switch name {
+		case "local":
+			chain = append(chain, NewLocalAuthenticator(s))
+		case "ldap":
+			chain = append(chain, NewLDAPAuthenticator(LDAPConfig{
+				URL:          config.Envs.LDAPURL,
+				BindDN:       config.Envs.LDAPBindDN,
+				BindPassword: config.Envs.LDAPBindPassword,
+				BaseDN:       config.Envs.LDAPBaseDN,
+				UserFilter:   config.Envs.LDAPUserFilter,
+				StartTLS:     config.Envs.LDAPStartTLS,
+				GroupRoles:   config.Envs.LDAPGroupRoles,
+				DefaultRole:  types.RoleUser,
+				Timeout:      config.Envs.LDAPTimeout,
+			}, s))
+		default:
+			slog.Warn("unknown authentication provider, ignoring", slog.String("provider", name))
+		}
+	}
+
+	return chain
+}
+
+// LocalAuthenticator checks passwords stored in the users table.
+type LocalAuthenticator struct {
+	store store.Store
+}
+
+func NewLocalAuthenticator(s store.Store) *LocalAuthenticator {
+	return &LocalAuthenticator{store: s}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return "local"
+}
+
+func (a *LocalAuthenticator) Authenticate(ctx context.Context, username, password string) (*types.User, error) {
+	user, err := a.store.GetUserByEmail(ctx, username)
+	if apierror.KindOf(err) == apierror.KindNotFound {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ok, needsRehash, err := VerifyPassword(user.Password, password)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	// upgrade hashes made with an older algorithm or weaker parameters
+	// while the plaintext is at hand; failure here must not block login
+	if needsRehash {
+		if hash, err := HashPassword(password); err == nil {
+			user.Password = hash
+			if err := a.store.UpdatePassword(ctx, user); err != nil {
+				slog.Error("failed to rehash password", slog.Int64("user_id", user.ID), slog.Any("error", err))
+			}
+		}
+	}
+
+	return user, nil
+}
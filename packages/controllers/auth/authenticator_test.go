@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/AriJaya07/go-rest-api/packages/models/store/storetest"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+// stubAuthenticator returns a fixed result and records that it was asked.
+type stubAuthenticator struct {
+	name  string
+	user  *types.User
+	err   error
+	calls *[]string
+}
+
+func (a stubAuthenticator) Name() string {
+	return a.name
+}
+
+func (a stubAuthenticator) Authenticate(ctx context.Context, username, password string) (*types.User, error) {
+	*a.calls = append(*a.calls, a.name)
+	return a.user, a.err
+}
+
+func TestChainAuthenticate(t *testing.T) {
+	errDown := errors.New("directory unreachable")
+	first := &types.User{ID: 1}
+	second := &types.User{ID: 2}
+
+	type result struct {
+		user *types.User
+		err  error
+	}
+	tests := []struct {
+		name    string
+		results []result
+		want    *types.User
+		err     error
+		calls   []string
+	}{
+		{name: "first success wins", results: []result{{user: first}, {user: second}},
+			want: first, calls: []string{"a"}},
+		{name: "falls back on invalid credentials", results: []result{{err: ErrInvalidCredentials}, {user: second}},
+			want: second, calls: []string{"a", "b"}},
+		{name: "falls back on failure", results: []result{{err: errDown}, {user: second}},
+			want: second, calls: []string{"a", "b"}},
+		{name: "all reject", results: []result{{err: ErrInvalidCredentials}, {err: ErrInvalidCredentials}},
+			err: ErrInvalidCredentials, calls: []string{"a", "b"}},
+		{name: "rejection wins over an earlier failure", results: []result{{err: errDown}, {err: ErrInvalidCredentials}},
+			err: ErrInvalidCredentials, calls: []string{"a", "b"}},
+		{name: "rejection wins over a later failure", results: []result{{err: ErrInvalidCredentials}, {err: errDown}},
+			err: ErrInvalidCredentials, calls: []string{"a", "b"}},
+		{name: "failure when nobody could answer", results: []result{{err: errDown}, {err: errDown}},
+			err: errDown, calls: []string{"a", "b"}},
+		{name: "empty chain", err: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			var chain Chain
+			for i, r := range tt.results {
+				chain = append(chain, stubAuthenticator{name: string(rune('a' + i)), user: r.user, err: r.err, calls: &calls})
+			}
+
+			user, err := chain.Authenticate(context.Background(), "a@example.com", "pw")
+			if user != tt.want || !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+				t.Errorf("got %+v, %v, want %+v, %v", user, err, tt.want, tt.err)
+			}
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("asked %v, want %v", calls, tt.calls)
+			}
+		})
+	}
+}
+
+func TestChainLocalThenLDAP(t *testing.T) {
+	ctx := context.Background()
+	mem := storetest.NewMemory()
+	hash, err := HashPassword("local-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, _ := mem.CreateUser(ctx, &types.User{Email: "local@example.com", Password: hash, Role: types.RoleUser})
+
+	dir := newTestDirectory()
+	chain := Chain{NewLocalAuthenticator(mem), newTestLDAPAuthenticator(dir, mem, nil)}
+	if got := chain.Name(); got != "local,ldap" {
+		t.Errorf("Name() = %q", got)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		// wantEmail is the user signed in, empty when rejected
+		wantEmail string
+	}{
+		{name: "local password", username: "local@example.com", password: "local-only", wantEmail: "local@example.com"},
+		{name: "directory password for a local user", username: "local@example.com", password: "local-pass", wantEmail: "local@example.com"},
+		{name: "directory only", username: "ada@example.com", password: "ada-pass", wantEmail: "ada@example.com"},
+		{name: "rejected by both", username: "ada@example.com", password: "wrong"},
+	}
+
+	for _, tt := range tests {
+		user, err := chain.Authenticate(ctx, tt.username, tt.password)
+		if tt.wantEmail == "" {
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("%s: got %+v, %v", tt.name, user, err)
+			}
+			continue
+		}
+		if err != nil || user.Email != tt.wantEmail {
+			t.Errorf("%s: got %+v, %v", tt.name, user, err)
+		}
+	}
+
+	// the directory login reused the local account rather than adding one
+	if got := mem.Identity("ldap:"+testLDAPURL, "uid=local,dc=example,dc=com"); got != local.ID {
+		t.Errorf("directory entry linked to user %d, want %d", got, local.ID)
+	}
+	if n := len(mem.Users()); n != 2 {
+		t.Errorf("%d users, want 2", n)
+	}
+
+	// a directory outage does not stop local users signing in
+	chain[1].(*LDAPAuthenticator).dial = func(string) (ldap.Client, error) { return nil, errors.New("connection refused") }
+	if _, err := chain.Authenticate(ctx, "local@example.com", "local-only"); err != nil {
+		t.Errorf("local login during outage: %v", err)
+	}
+	// and a wrong password or unknown user is still a rejection
+	for _, username := range []string{"local@example.com", "nobody@example.com"} {
+		if _, err := chain.Authenticate(ctx, username, "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("%s with a wrong password during outage: %v", username, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/models/store/storetest"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+func TestSetSessionCookies(t *testing.T) {
+	w := httptest.NewRecorder()
+	SetSessionCookies(w, "session-token", time.Now().Add(time.Hour))
+
+	cookies := map[string]*http.Cookie{}
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+
+	session, csrf := cookies[SessionCookie], cookies[CSRFCookie]
+	if session == nil || csrf == nil {
+		t.Fatalf("got cookies %v", cookies)
+	}
+	if session.Value != "session-token" || !session.HttpOnly {
+		t.Errorf("session cookie %+v must hold the token and be HttpOnly", session)
+	}
+	// the frontend reads the CSRF cookie to echo it in the header
+	if csrf.Value != CSRFToken("session-token") || csrf.HttpOnly {
+		t.Errorf("CSRF cookie %+v must hold the derived token and be readable", csrf)
+	}
+	if CSRFToken("session-token") == CSRFToken("other-session") {
+		t.Error("sessions share a CSRF token")
+	}
+}
+
+func TestWithJWTAuthCSRF(t *testing.T) {
+	ctx := context.Background()
+	mem := storetest.NewMemory()
+	user, _ := mem.CreateUser(ctx, &types.User{Email: "a@example.com", Role: types.RoleUser})
+	session, err := CreateJWT([]byte(config.Envs.JWTSecret), user.ID, user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := CreateJWT([]byte(config.Envs.JWTSecret), user.ID+1, "b@example.com")
+
+	handler := WithJWTAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}, mem)
+
+	tests := []struct {
+		name   string
+		method string
+		// cookie and bearer carry the session token; header is the CSRF
+		// header and csrfCookie a planted CSRF cookie
+		cookie     bool
+		bearer     bool
+		header     string
+		csrfCookie string
+		status     int
+	}{
+		{name: "safe method without token", method: http.MethodGet, cookie: true, status: http.StatusNoContent},
+		{name: "HEAD without token", method: http.MethodHead, cookie: true, status: http.StatusNoContent},
+		{name: "OPTIONS without token", method: http.MethodOptions, cookie: true, status: http.StatusNoContent},
+		{name: "POST without token", method: http.MethodPost, cookie: true, status: http.StatusForbidden},
+		{name: "POST with matching token", method: http.MethodPost, cookie: true, header: CSRFToken(session), status: http.StatusNoContent},
+		{name: "PUT without token", method: http.MethodPut, cookie: true, status: http.StatusForbidden},
+		{name: "PATCH without token", method: http.MethodPatch, cookie: true, status: http.StatusForbidden},
+		{name: "DELETE with matching token", method: http.MethodDelete, cookie: true, header: CSRFToken(session), status: http.StatusNoContent},
+		{name: "token of another session", method: http.MethodPost, cookie: true, header: CSRFToken(other), status: http.StatusForbidden},
+		{name: "planted cookie and header that agree", method: http.MethodPost, cookie: true,
+			header: "attacker-chosen", csrfCookie: "attacker-chosen", status: http.StatusForbidden},
+		{name: "session token as CSRF token", method: http.MethodPost, cookie: true, header: session, status: http.StatusForbidden},
+		{name: "bearer token is exempt", method: http.MethodPost, bearer: true, status: http.StatusNoContent},
+		{name: "bearer token wins over cookie", method: http.MethodPost, bearer: true, cookie: true, status: http.StatusNoContent},
+		{name: "no session", method: http.MethodPost, header: CSRFToken(session), status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/projects", nil)
+			if tt.cookie {
+				r.AddCookie(&http.Cookie{Name: SessionCookie, Value: session})
+			}
+			if tt.bearer {
+				r.Header.Set("Authorization", session)
+			}
+			if tt.header != "" {
+				r.Header.Set(CSRFHeader, tt.header)
+			}
+			if tt.csrfCookie != "" {
+				r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.csrfCookie})
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusForbidden && w.Header().Get("Content-Type") != apierror.ContentType {
+				t.Errorf("rejection is not problem+json: %s", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/metrics"
+	"github.com/AriJaya07/go-rest-api/packages/models/store"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+// LDAPConfig configures search-then-bind authentication against a
+// directory server.
+type LDAPConfig struct {
+	URL          string
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter is a search filter with a single %s for the escaped
+	// username, e.g. "(mail=%s)".
+	UserFilter string
+	StartTLS   bool
+	// GroupRoles maps group DNs (compared case-insensitively) to roles.
+	// When a user is in several mapped groups the admin role wins.
+	GroupRoles  map[string]string
+	DefaultRole string
+	// Timeout bounds connecting and each request, so an unreachable
+	// directory does not hold up logins that other providers can answer.
+	Timeout time.Duration
+}
+
+// LDAPAuthenticator binds as the user found in the directory and provisions
+// a matching local user on first login.
+type LDAPAuthenticator struct {
+	cfg   LDAPConfig
+	store store.Store
+	// dial connects to the directory; tests replace it with a fake.
+	dial func(url string) (ldap.Client, error)
+}
+
+func NewLDAPAuthenticator(cfg LDAPConfig, s store.Store) *LDAPAuthenticator {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(mail=%s)"
+	}
+	if cfg.DefaultRole == "" {
+		cfg.DefaultRole = types.RoleUser
+	}
+
+	a := &LDAPAuthenticator{cfg: cfg, store: s}
+	a.dial = func(url string) (ldap.Client, error) { return dialLDAP(url, cfg.Timeout) }
+
+	return a
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return "ldap"
+}
+
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*types.User, error) {
+	// an empty password would be an unauthenticated bind, which most
+	// servers accept
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial(a.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.cfg.StartTLS {
+		host := strings.TrimPrefix(strings.TrimPrefix(a.cfg.URL, "ldap://"), "ldaps://")
+		host, _, _ = strings.Cut(host, ":")
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.cfg.BindDN != "" {
+		if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("service bind: %w", err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn", "mail", "givenName", "sn", "memberOf"},
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	email := entry.GetAttributeValue("mail")
+	if email == "" {
+		return nil, errors.New("directory entry has no mail attribute")
+	}
+
+	return a.provision(ctx, entry.DN, email, entry.GetAttributeValue("givenName"), entry.GetAttributeValue("sn"), a.roleFor(entry.GetAttributeValues("memberOf")))
+}
+
+func dialLDAP(url string, timeout time.Duration) (ldap.Client, error) {
+	conn, err := ldap.DialURL(url, ldap.DialWithDialer(&net.Dialer{Timeout: timeout}))
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		conn.SetTimeout(timeout)
+	}
+
+	return conn, nil
+}
+
+func (a *LDAPAuthenticator) roleFor(groups []string) string {
+	role := a.cfg.DefaultRole
+
+	for _, g := range groups {
+		for dn, r := range a.cfg.GroupRoles {
+			if !strings.EqualFold(g, dn) {
+				continue
+			}
+			if r == types.RoleAdmin {
+				return r
+			}
+			role = r
+		}
+	}
+
+	return role
+}
+
+// provision returns the local user for a directory entry, creating it on
+// first login and keeping its role in sync with the directory groups.
+func (a *LDAPAuthenticator) provision(ctx context.Context, dn, email, firstName, lastName, role string) (*types.User, error) {
+	issuer := "ldap:" + a.cfg.URL
+
+	user, err := a.store.GetUserByIdentity(ctx, issuer, dn)
+	if apierror.KindOf(err) == apierror.KindNotFound {
+		user, err = a.store.GetUserByEmail(ctx, email)
+		if apierror.KindOf(err) == apierror.KindNotFound {
+			user, err = a.createUser(ctx, email, firstName, lastName, role)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err := a.store.LinkIdentity(ctx, user.ID, issuer, dn); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(a.cfg.GroupRoles) > 0 && user.Role != role {
+		user.Role = role
+		if err := a.store.UpdateUserRole(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (a *LDAPAuthenticator) createUser(ctx context.Context, email, firstName, lastName, role string) (*types.User, error) {
+	// the local password is never used; the directory stays the source of truth
+	random, err := GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	hashedPW, err := HashPassword(random)
+	if err != nil {
+		return nil, err
+	}
+
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(email, "@")
+	}
+
+	user, err := a.store.CreateUser(ctx, &types.User{
+		Email:     email,
+		FirstName: firstName,
+		LastName:  lastName,
+		Password:  hashedPW,
+		Role:      role,
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.UsersRegistered.Inc()
+
+	return user, nil
+}
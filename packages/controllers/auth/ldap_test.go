@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/AriJaya07/go-rest-api/packages/models/store/storetest"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+const (
+	testLDAPURL     = "ldap://directory.example.com"
+	testServiceDN   = "cn=service,dc=example,dc=com"
+	testServicePass = "service-secret"
+	testAdminsDN    = "cn=Admins,ou=groups,dc=example,dc=com"
+	testStaffDN     = "cn=staff,ou=groups,dc=example,dc=com"
+)
+
+type directoryEntry struct {
+	password string
+	attrs    map[string][]string
+}
+
+// fakeDirectory answers the binds and searches LDAPAuthenticator makes.
+// Searches only match the default (mail=%s) filter, and only after the
+// service account has bound.
+type fakeDirectory struct {
+	ldap.Client
+
+	entries map[string]directoryEntry // by DN
+	bound   string
+}
+
+func (d *fakeDirectory) Bind(dn, password string) error {
+	if dn == testServiceDN && password == testServicePass {
+		d.bound = dn
+		return nil
+	}
+	if e, ok := d.entries[dn]; ok && e.password == password {
+		d.bound = dn
+		return nil
+	}
+	return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+}
+
+func (d *fakeDirectory) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if d.bound != testServiceDN {
+		return nil, ldap.NewError(ldap.LDAPResultInsufficientAccessRights, errors.New("not bound"))
+	}
+
+	result := &ldap.SearchResult{}
+	for dn, e := range d.entries {
+		for _, mail := range e.attrs["mail"] {
+			if req.Filter == "(mail="+ldap.EscapeFilter(mail)+")" {
+				result.Entries = append(result.Entries, ldap.NewEntry(dn, e.attrs))
+			}
+		}
+	}
+	return result, nil
+}
+
+func (d *fakeDirectory) Close() error {
+	return nil
+}
+
+func newTestDirectory() *fakeDirectory {
+	return &fakeDirectory{entries: map[string]directoryEntry{
+		"uid=ada,dc=example,dc=com": {password: "ada-pass", attrs: map[string][]string{
+			"mail": {"ada@example.com"}, "givenName": {"Ada"}, "sn": {"Lovelace"},
+			"memberOf": {testStaffDN, "CN=ADMINS,OU=GROUPS,DC=EXAMPLE,DC=COM"},
+		}},
+		"uid=grace,dc=example,dc=com": {password: "grace-pass", attrs: map[string][]string{
+			"mail": {"grace@example.com"}, "memberOf": {testStaffDN},
+		}},
+		"uid=local,dc=example,dc=com": {password: "local-pass", attrs: map[string][]string{
+			"mail": {"local@example.com"}, "givenName": {"Directory"},
+		}},
+	}}
+}
+
+func newTestLDAPAuthenticator(dir *fakeDirectory, mem *storetest.Memory, groupRoles map[string]string) *LDAPAuthenticator {
+	a := NewLDAPAuthenticator(LDAPConfig{
+		URL:          testLDAPURL,
+		BindDN:       testServiceDN,
+		BindPassword: testServicePass,
+		BaseDN:       "dc=example,dc=com",
+		GroupRoles:   groupRoles,
+	}, mem)
+	a.dial = func(url string) (ldap.Client, error) {
+		if url != testLDAPURL {
+			return nil, errors.New("unexpected url " + url)
+		}
+		dir.bound = ""
+		return dir, nil
+	}
+	return a
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	groupRoles := map[string]string{testAdminsDN: types.RoleAdmin, testStaffDN: "staff"}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		// role and firstName of the resulting user; empty when rejected
+		role      string
+		firstName string
+		users     int // afterwards
+		err       error
+	}{
+		{name: "provisions on first login", username: "ada@example.com", password: "ada-pass",
+			role: types.RoleAdmin, firstName: "Ada", users: 2},
+		{name: "first name from the email", username: "grace@example.com", password: "grace-pass",
+			role: "staff", firstName: "grace", users: 2},
+		{name: "links a local user with the same email", username: "local@example.com", password: "local-pass",
+			role: types.RoleUser, firstName: "Local", users: 1},
+		{name: "wrong password", username: "ada@example.com", password: "wrong", users: 1, err: ErrInvalidCredentials},
+		{name: "unknown user", username: "nobody@example.com", password: "x", users: 1, err: ErrInvalidCredentials},
+		{name: "filter is escaped", username: "*", password: "ada-pass", users: 1, err: ErrInvalidCredentials},
+		{name: "empty password is not an anonymous bind", username: "ada@example.com", users: 1, err: ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			mem := storetest.NewMemory()
+			mem.CreateUser(ctx, &types.User{Email: "local@example.com", FirstName: "Local", Role: types.RoleUser})
+			a := newTestLDAPAuthenticator(newTestDirectory(), mem, groupRoles)
+
+			user, err := a.Authenticate(ctx, tt.username, tt.password)
+			if n := len(mem.Users()); n != tt.users {
+				t.Errorf("%d users, want %d", n, tt.users)
+			}
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if user.Role != tt.role || user.FirstName != tt.firstName || user.Email != tt.username {
+				t.Errorf("got %+v", user)
+			}
+			if stored, _ := mem.GetUserByEmail(ctx, tt.username); stored.Role != tt.role {
+				t.Errorf("stored role %q, want %q", stored.Role, tt.role)
+			}
+			uid, _, _ := strings.Cut(tt.username, "@")
+			if mem.Identity("ldap:"+testLDAPURL, "uid="+uid+",dc=example,dc=com") != user.ID {
+				t.Error("directory entry was not linked to the user")
+			}
+		})
+	}
+}
+
+func TestLDAPRoleFollowsDirectory(t *testing.T) {
+	ctx := context.Background()
+	mem := storetest.NewMemory()
+	dir := newTestDirectory()
+	a := newTestLDAPAuthenticator(dir, mem, map[string]string{testAdminsDN: types.RoleAdmin})
+
+	first, err := a.Authenticate(ctx, "ada@example.com", "ada-pass")
+	if err != nil || first.Role != types.RoleAdmin {
+		t.Fatalf("got %+v, %v", first, err)
+	}
+
+	// removed from the admins group in the directory
+	entry := dir.entries["uid=ada,dc=example,dc=com"]
+	entry.attrs["memberOf"] = []string{testStaffDN}
+
+	second, err := a.Authenticate(ctx, "ada@example.com", "ada-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID || second.Role != types.RoleUser {
+		t.Errorf("got %+v, want user %d demoted to %s", second, first.ID, types.RoleUser)
+	}
+	// the returned user carries the version the role change moved it to
+	if stored := mem.Users()[0]; second.Version != first.Version+1 || stored.Version != second.Version {
+		t.Errorf("version %d, stored %d, want %d", second.Version, stored.Version, first.Version+1)
+	}
+	if n := len(mem.Users()); n != 1 {
+		t.Errorf("%d users, want 1", n)
+	}
+}
+
+func TestLDAPErrors(t *testing.T) {
+	ctx := context.Background()
+
+	down := NewLDAPAuthenticator(LDAPConfig{URL: testLDAPURL}, storetest.NewMemory())
+	down.dial = func(string) (ldap.Client, error) { return nil, errors.New("connection refused") }
+	if _, err := down.Authenticate(ctx, "ada@example.com", "ada-pass"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unreachable directory: got %v", err)
+	}
+
+	dir := newTestDirectory()
+	wrongService := newTestLDAPAuthenticator(dir, storetest.NewMemory(), nil)
+	wrongService.cfg.BindPassword = "wrong"
+	if _, err := wrongService.Authenticate(ctx, "ada@example.com", "ada-pass"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("failed service bind: got %v", err)
+	}
+}
+
+func TestLDAPRoleFor(t *testing.T) {
+	a := NewLDAPAuthenticator(LDAPConfig{
+		GroupRoles: map[string]string{
+			testAdminsDN: types.RoleAdmin,
+			testStaffDN:  "staff",
+		},
+	}, nil)
+
+	tests := []struct {
+		name   string
+		groups []string
+		want   string
+	}{
+		{name: "no groups", want: types.RoleUser},
+		{name: "unmapped group", groups: []string{"cn=other,dc=example,dc=com"}, want: types.RoleUser},
+		{name: "mapped group", groups: []string{testStaffDN}, want: "staff"},
+		{name: "case-insensitive DN", groups: []string{"CN=Staff,OU=Groups,DC=Example,DC=Com"}, want: "staff"},
+		{name: "admin wins after", groups: []string{testStaffDN, testAdminsDN}, want: types.RoleAdmin},
+		{name: "admin wins before", groups: []string{testAdminsDN, testStaffDN}, want: types.RoleAdmin},
+	}
+
+	for _, tt := range tests {
+		if got := a.roleFor(tt.groups); got != tt.want {
+			t.Errorf("%s: roleFor(%v) = %q, want %q", tt.name, tt.groups, got, tt.want)
+		}
+	}
+
+	custom := NewLDAPAuthenticator(LDAPConfig{DefaultRole: "viewer"}, nil)
+	if got := custom.roleFor([]string{testStaffDN}); got != "viewer" {
+		t.Errorf("default role = %q, want viewer", got)
+	}
+}
+
+func TestLDAPTimeout(t *testing.T) {
+	// a directory that accepts connections but never answers
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, c := range conns {
+				c.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	a := NewLDAPAuthenticator(LDAPConfig{
+		URL:          "ldap://" + ln.Addr().String(),
+		BindDN:       testServiceDN,
+		BindPassword: testServicePass,
+		Timeout:      100 * time.Millisecond,
+	}, storetest.NewMemory())
+
+	start := time.Now()
+	_, err = a.Authenticate(context.Background(), "ada@example.com", "ada-pass")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("silent directory: got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("gave up after %s, want about the 100ms timeout", elapsed)
+	}
+}
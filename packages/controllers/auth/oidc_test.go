@@ -0,0 +1,336 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/golang-jwt/jwt"
+)
+
+// testProvider is an identity provider that issues whatever ID token the
+// test sets, after checking the PKCE verifier of the code exchange.
+type testProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	issuer    string // in the discovery document
+	challenge string // from the last authorization request
+	idToken   string
+	jwksCalls int
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &testProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		json.NewEncoder(w).Encode(oidcDiscovery{
+			Issuer:                p.issuer,
+			AuthorizationEndpoint: p.URL + "/authorize",
+			TokenEndpoint:         p.URL + "/token",
+			JWKSURI:               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.jwksCalls++
+		p.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kid": "key-1",
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if r.PostFormValue("code") != "the-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.idToken})
+	})
+
+	p.Server = httptest.NewServer(mux)
+	p.issuer = p.URL
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+func (p *testProvider) provider() *OIDCProvider {
+	return NewOIDCProvider(OIDCConfig{
+		Issuer:      p.URL,
+		ClientID:    "client",
+		RedirectURL: "https://app.example.com/callback",
+	}, p.Client())
+}
+
+func (p *testProvider) setIDToken(raw string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.idToken = raw
+}
+
+// sign returns an ID token with the usual claims, changed by edit, signed
+// by key with the given key ID.
+func (p *testProvider) sign(t *testing.T, key *rsa.PrivateKey, kid string, nonce string, edit func(jwt.MapClaims)) string {
+	t.Helper()
+
+	claims := jwt.MapClaims{
+		"iss":            p.URL,
+		"aud":            "client",
+		"sub":            "subject-1",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "a@example.com",
+		"email_verified": true,
+		"given_name":     "Ada",
+		"family_name":    "Lovelace",
+	}
+	if edit != nil {
+		edit(claims)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+// authorize starts a login as the browser would and records the PKCE
+// challenge at the provider.
+func (p *testProvider) authorize(t *testing.T, op *OIDCProvider) *OIDCAuthRequest {
+	t.Helper()
+
+	req, err := NewOIDCAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirect, err := op.AuthCodeURL(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	p.mu.Lock()
+	p.challenge = q.Get("code_challenge")
+	p.mu.Unlock()
+
+	return req
+}
+
+func TestOIDCAuthCodeURL(t *testing.T) {
+	p := newTestProvider(t)
+	op := p.provider()
+
+	req, err := NewOIDCAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirect, err := op.AuthCodeURL(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(redirect, p.URL+"/authorize?") {
+		t.Fatalf("redirect %s is not to the discovered authorization endpoint", redirect)
+	}
+
+	u, _ := url.Parse(redirect)
+	q := u.Query()
+	sum := sha256.Sum256([]byte(req.CodeVerifier))
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client",
+		"redirect_uri":          "https://app.example.com/callback",
+		"scope":                 "openid email profile",
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := q.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	p := newTestProvider(t)
+	p.mu.Lock()
+	p.issuer = "https://other.example.com"
+	p.mu.Unlock()
+
+	req, _ := NewOIDCAuthRequest()
+	if _, err := p.provider().AuthCodeURL(req); err == nil {
+		t.Error("discovery for another issuer was accepted")
+	}
+}
+
+func TestOIDCNotConfigured(t *testing.T) {
+	req, _ := NewOIDCAuthRequest()
+	if _, err := NewOIDCProvider(OIDCConfig{}, nil).AuthCodeURL(req); err != errOIDCNotConfigured {
+		t.Errorf("got %v, want %v", err, errOIDCNotConfigured)
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	p := newTestProvider(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		// token builds the ID token for the request's nonce
+		token func(nonce string) string
+		// verifier replaces the request's PKCE verifier when set
+		verifier string
+		ok       bool
+	}{
+		{name: "valid", ok: true,
+			token: func(nonce string) string { return p.sign(t, p.key, "key-1", nonce, nil) }},
+		{name: "wrong PKCE verifier", verifier: "not-the-verifier",
+			token: func(nonce string) string { return p.sign(t, p.key, "key-1", nonce, nil) }},
+		{name: "signed by another key",
+			token: func(nonce string) string { return p.sign(t, otherKey, "key-1", nonce, nil) }},
+		{name: "unknown key",
+			token: func(nonce string) string { return p.sign(t, p.key, "key-2", nonce, nil) }},
+		{name: "not signed",
+			token: func(nonce string) string {
+				raw, _ := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"iss": p.URL, "aud": "client", "sub": "s", "nonce": nonce}).
+					SignedString(jwt.UnsafeAllowNoneSignatureType)
+				return raw
+			}},
+		{name: "wrong issuer",
+			token: func(nonce string) string {
+				return p.sign(t, p.key, "key-1", nonce, func(c jwt.MapClaims) { c["iss"] = "https://other.example.com" })
+			}},
+		{name: "wrong audience",
+			token: func(nonce string) string {
+				return p.sign(t, p.key, "key-1", nonce, func(c jwt.MapClaims) { c["aud"] = "other-client" })
+			}},
+		{name: "expired",
+			token: func(nonce string) string {
+				return p.sign(t, p.key, "key-1", nonce, func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() })
+			}},
+		{name: "no expiry",
+			token: func(nonce string) string {
+				return p.sign(t, p.key, "key-1", nonce, func(c jwt.MapClaims) { delete(c, "exp") })
+			}},
+		{name: "wrong nonce",
+			token: func(nonce string) string { return p.sign(t, p.key, "key-1", "other-nonce", nil) }},
+		{name: "no subject",
+			token: func(nonce string) string {
+				return p.sign(t, p.key, "key-1", nonce, func(c jwt.MapClaims) { delete(c, "sub") })
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := p.provider()
+			req := p.authorize(t, op)
+			p.setIDToken(tt.token(req.Nonce))
+
+			if tt.verifier != "" {
+				req.CodeVerifier = tt.verifier
+			}
+
+			id, err := op.Exchange("the-code", req)
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("accepted, got %+v", id)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := OIDCIdentity{Issuer: p.URL, Subject: "subject-1", Email: "a@example.com", EmailVerified: true, GivenName: "Ada", FamilyName: "Lovelace"}
+			if *id != want {
+				t.Errorf("got %+v, want %+v", *id, want)
+			}
+		})
+	}
+}
+
+func TestOIDCKeysAreCached(t *testing.T) {
+	p := newTestProvider(t)
+	op := p.provider()
+
+	for i := 0; i < 2; i++ {
+		req := p.authorize(t, op)
+		p.setIDToken(p.sign(t, p.key, "key-1", req.Nonce, nil))
+		if _, err := op.Exchange("the-code", req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// an unknown key ID refetches the set once, for key rotation
+	req := p.authorize(t, op)
+	p.setIDToken(p.sign(t, p.key, "key-2", req.Nonce, nil))
+	if _, err := op.Exchange("the-code", req); err == nil {
+		t.Fatal("token signed with an unknown key was accepted")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.jwksCalls != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", p.jwksCalls)
+	}
+}
+
+func TestOIDCStateToken(t *testing.T) {
+	req, err := NewOIDCAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := CreateOIDCStateToken([]byte(config.Envs.JWTSecret), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseOIDCStateToken(token)
+	if err != nil || *got != *req {
+		t.Errorf("got %+v, %v, want %+v", got, err, req)
+	}
+
+	challenge, _ := CreateLoginChallenge([]byte(config.Envs.JWTSecret), 1)
+	if _, err := ParseOIDCStateToken(challenge); err == nil {
+		t.Error("a login challenge was accepted as login state")
+	}
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/AriJaya07/go-rest-api/packages/config"
+)
+
+const (
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmBcrypt   = "bcrypt"
+)
+
+var errUnknownHashFormat = errors.New("unknown password hash format")
+
+// Argon2Params are the argon2id cost parameters. They are encoded into every
+// hash so they can be raised later without invalidating existing passwords.
+type Argon2Params struct {
+	Memory  uint32 // KiB
+	Time    uint32
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// PasswordHasher creates hashes with the configured algorithm and verifies
+// hashes of any supported algorithm.
+//
+// Argon2id hashes use the PHC string format
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>; bcrypt hashes keep their
+// native $2a$/$2b$ format, which already encodes the cost.
+type PasswordHasher struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+func NewPasswordHasher() *PasswordHasher {
+	return &PasswordHasher{
+		Algorithm: config.Envs.PasswordHashAlgorithm,
+		Argon2: Argon2Params{
+			Memory:  uint32(config.Envs.Argon2Memory),
+			Time:    uint32(config.Envs.Argon2Time),
+			Threads: uint8(config.Envs.Argon2Threads),
+			SaltLen: 16,
+			KeyLen:  32,
+		},
+		BcryptCost: config.Envs.BcryptCost,
+	}
+}
+
+var defaultHasher = NewPasswordHasher()
+
+// Validate rejects settings Hash and Verify would disagree on. An unknown
+// algorithm, for one, would hash with argon2id while Verify marked every
+// hash as stale, and bcrypt silently replaces an out of range cost.
+func (h *PasswordHasher) Validate() error {
+	switch h.Algorithm {
+	case AlgorithmArgon2id:
+		p := h.Argon2
+		if p.Memory == 0 || p.Time == 0 || p.Threads == 0 || p.SaltLen == 0 || p.KeyLen == 0 {
+			return fmt.Errorf("argon2id memory, time and threads must be positive, got m=%d,t=%d,p=%d", p.Memory, p.Time, p.Threads)
+		}
+	case AlgorithmBcrypt:
+		if h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, h.BcryptCost)
+		}
+	default:
+		return fmt.Errorf("unknown password hash algorithm %q, want %s or %s", h.Algorithm, AlgorithmArgon2id, AlgorithmBcrypt)
+	}
+
+	return nil
+}
+
+// ValidatePasswordHasher checks the hasher configured by
+// PASSWORD_HASH_ALGORITHM and its cost settings, so a typo stops the server
+// at startup.
+func ValidatePasswordHasher() error {
+	return defaultHasher.Validate()
+}
+
+func (h *PasswordHasher) Hash(pw string) (string, error) {
+	if h.Algorithm == AlgorithmBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(pw), h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, h.Argon2.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	p := h.Argon2
+	key := argon2.IDKey([]byte(pw), salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Time, p.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify reports whether pw matches the encoded hash, and whether the hash
+// should be replaced because it was made with a different algorithm or
+// outdated parameters.
+func (h *PasswordHasher) Verify(encoded, pw string) (ok bool, needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		p, salt, key, err := decodeArgon2(encoded)
+		if err != nil {
+			return false, false, err
+		}
+
+		other := argon2.IDKey([]byte(pw), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false, nil
+		}
+
+		stale := h.Algorithm != AlgorithmArgon2id ||
+			p.Memory != h.Argon2.Memory || p.Time != h.Argon2.Time || p.Threads != h.Argon2.Threads ||
+			uint32(len(salt)) != h.Argon2.SaltLen || uint32(len(key)) != h.Argon2.KeyLen
+		return true, stale, nil
+
+	case strings.HasPrefix(encoded, "$2"):
+		if err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(pw)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, false, err
+		}
+
+		return true, h.Algorithm != AlgorithmBcrypt || cost != h.BcryptCost, nil
+	}
+
+	return false, false, errUnknownHashFormat
+}
+
+func decodeArgon2(encoded string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return p, nil, nil, errUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, nil, nil, errUnknownHashFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, errUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, errUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, errUnknownHashFormat
+	}
+
+	p.SaltLen = uint32(len(salt))
+	p.KeyLen = uint32(len(key))
+
+	return p, salt, key, nil
+}
+
+// VerifyPassword checks pw against a stored hash using the configured
+// hasher.
+func VerifyPassword(encoded, pw string) (ok bool, needsRehash bool, err error) {
+	return defaultHasher.Verify(encoded, pw)
+}
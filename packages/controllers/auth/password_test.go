@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/AriJaya07/go-rest-api/packages/models/store/storetest"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+// testArgon2 keeps the tests fast; production parameters come from config.
+var testArgon2 = Argon2Params{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}
+
+func TestArgon2PHCFormat(t *testing.T) {
+	h := &PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2}
+
+	encoded, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	format := regexp.MustCompile(`^\$argon2id\$v=19\$m=1024,t=1,p=1\$[A-Za-z0-9+/]{22}\$[A-Za-z0-9+/]{43}$`)
+	if !format.MatchString(encoded) {
+		t.Fatalf("hash %s is not in PHC format", encoded)
+	}
+
+	p, salt, key, err := decodeArgon2(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != testArgon2 || len(salt) != 16 || len(key) != 32 {
+		t.Errorf("decoded %+v with %d byte salt and %d byte key", p, len(salt), len(key))
+	}
+
+	again, _ := h.Hash("correct horse")
+	if again == encoded {
+		t.Error("two hashes of the same password share a salt")
+	}
+
+	// a hash made elsewhere with the same algorithm verifies
+	fixedSalt := []byte("0123456789abcdef")
+	fixedKey := argon2.IDKey([]byte("correct horse"), fixedSalt, 2, 2048, 1, 32)
+	external := fmt.Sprintf("$argon2id$v=19$m=2048,t=2,p=1$%s$%s",
+		base64.RawStdEncoding.EncodeToString(fixedSalt), base64.RawStdEncoding.EncodeToString(fixedKey))
+	if ok, _, err := h.Verify(external, "correct horse"); !ok || err != nil {
+		t.Errorf("external hash: ok = %v, err = %v", ok, err)
+	}
+}
+
+func TestDecodeArgon2Rejects(t *testing.T) {
+	valid, _ := (&PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2}).Hash("pw")
+	parts := strings.Split(valid, "$")
+
+	tests := map[string]string{
+		"missing key":   strings.Join(parts[:5], "$"),
+		"old version":   strings.Replace(valid, "v=19", "v=16", 1),
+		"bad params":    strings.Replace(valid, "m=1024,t=1,p=1", "m=1024;t=1", 1),
+		"bad salt":      strings.Replace(valid, parts[4], "not*base64", 1),
+		"bad key":       strings.Replace(valid, parts[5], "not*base64", 1),
+		"extra segment": valid + "$x",
+	}
+
+	h := &PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2}
+	for name, encoded := range tests {
+		if ok, _, err := h.Verify(encoded, "pw"); ok || !errors.Is(err, errUnknownHashFormat) {
+			t.Errorf("%s: ok = %v, err = %v", name, ok, err)
+		}
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	argon := &PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2, BcryptCost: bcrypt.MinCost}
+	bc := &PasswordHasher{Algorithm: AlgorithmBcrypt, Argon2: testArgon2, BcryptCost: bcrypt.MinCost}
+
+	stronger := *argon
+	stronger.Argon2.Time = 2
+	costlier := *bc
+	costlier.BcryptCost = bcrypt.MinCost + 1
+
+	argonHash, _ := argon.Hash("pw")
+	bcryptHash, _ := bc.Hash("pw")
+
+	tests := []struct {
+		name        string
+		hasher      *PasswordHasher
+		encoded     string
+		password    string
+		ok          bool
+		needsRehash bool
+		err         error
+	}{
+		{name: "argon2id", hasher: argon, encoded: argonHash, password: "pw", ok: true},
+		{name: "argon2id wrong password", hasher: argon, encoded: argonHash, password: "pW"},
+		{name: "argon2id with raised parameters", hasher: &stronger, encoded: argonHash, password: "pw", ok: true, needsRehash: true},
+		{name: "bcrypt fallback", hasher: argon, encoded: bcryptHash, password: "pw", ok: true, needsRehash: true},
+		{name: "bcrypt fallback wrong password", hasher: argon, encoded: bcryptHash, password: "pW"},
+		{name: "bcrypt", hasher: bc, encoded: bcryptHash, password: "pw", ok: true},
+		{name: "bcrypt with raised cost", hasher: &costlier, encoded: bcryptHash, password: "pw", ok: true, needsRehash: true},
+		{name: "argon2id under bcrypt", hasher: bc, encoded: argonHash, password: "pw", ok: true, needsRehash: true},
+		{name: "unknown format", hasher: argon, encoded: "plaintext", password: "plaintext", err: errUnknownHashFormat},
+	}
+
+	for _, tt := range tests {
+		ok, needsRehash, err := tt.hasher.Verify(tt.encoded, tt.password)
+		if ok != tt.ok || needsRehash != tt.needsRehash || !errors.Is(err, tt.err) {
+			t.Errorf("%s: got %v, %v, %v, want %v, %v, %v", tt.name, ok, needsRehash, err, tt.ok, tt.needsRehash, tt.err)
+		}
+	}
+}
+
+func TestPasswordHasherValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		ok     bool
+	}{
+		{name: "argon2id", hasher: PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: testArgon2}, ok: true},
+		{name: "bcrypt", hasher: PasswordHasher{Algorithm: AlgorithmBcrypt, BcryptCost: 10}, ok: true},
+		{name: "unknown algorithm", hasher: PasswordHasher{Algorithm: "argon2", Argon2: testArgon2}},
+		{name: "empty algorithm", hasher: PasswordHasher{Argon2: testArgon2}},
+		{name: "argon2id without threads", hasher: PasswordHasher{Algorithm: AlgorithmArgon2id, Argon2: Argon2Params{Memory: 1024, Time: 1, SaltLen: 16, KeyLen: 32}}},
+		{name: "bcrypt cost too low", hasher: PasswordHasher{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost - 1}},
+		{name: "bcrypt cost too high", hasher: PasswordHasher{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MaxCost + 1}},
+	}
+
+	for _, tt := range tests {
+		if err := tt.hasher.Validate(); (err == nil) != tt.ok {
+			t.Errorf("%s: Validate() = %v", tt.name, err)
+		}
+	}
+
+	if err := ValidatePasswordHasher(); err != nil {
+		t.Errorf("default configuration: %v", err)
+	}
+}
+
+func TestLocalAuthenticatorRehashes(t *testing.T) {
+	ctx := context.Background()
+	mem := storetest.NewMemory()
+
+	old, _ := (&PasswordHasher{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}).Hash("correct horse")
+	user, _ := mem.CreateUser(ctx, &types.User{Email: "a@example.com", Password: old, Role: types.RoleUser})
+	a := NewLocalAuthenticator(mem)
+	stored := func() string {
+		u, _ := mem.GetUserByID(ctx, fmt.Sprint(user.ID))
+		return u.Password
+	}
+
+	if _, err := a.Authenticate(ctx, "a@example.com", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password: %v", err)
+	}
+	if stored() != old {
+		t.Fatal("a failed login changed the hash")
+	}
+
+	if _, err := a.Authenticate(ctx, "a@example.com", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	upgraded := stored()
+	if !strings.HasPrefix(upgraded, "$argon2id$") {
+		t.Fatalf("bcrypt hash was not upgraded, stored %s", upgraded)
+	}
+
+	if _, err := a.Authenticate(ctx, "a@example.com", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if stored() != upgraded {
+		t.Error("a current hash was rehashed")
+	}
+
+	if _, err := a.Authenticate(ctx, "nobody@example.com", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown user: %v", err)
+	}
+}
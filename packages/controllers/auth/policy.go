@@ -0,0 +1,112 @@
+package auth
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]bool {
+	m := map[string]bool{}
+	for _, p := range strings.Split(commonPasswordList, "\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			m[strings.ToLower(p)] = true
+		}
+	}
+	return m
+}()
+
+// PasswordPolicy describes the rules a new password must satisfy.
+type PasswordPolicy struct {
+	MinLength      int
+	MaxBytes       int // bcrypt silently truncates anything past 72 bytes
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	RejectPersonal bool
+	RejectCommon   bool
+}
+
+func NewPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:      config.Envs.PasswordMinLength,
+		MaxBytes:       config.Envs.PasswordMaxBytes,
+		RequireUpper:   config.Envs.PasswordRequireUpper,
+		RequireLower:   config.Envs.PasswordRequireLower,
+		RequireDigit:   config.Envs.PasswordRequireDigit,
+		RequireSymbol:  config.Envs.PasswordRequireSymbol,
+		RejectPersonal: true,
+		RejectCommon:   true,
+	}
+}
+
+var defaultPolicy = NewPasswordPolicy()
+
+// Check returns every rule pw breaks, or nil if it is acceptable. The user
+// supplies the email and names the password must not contain.
+func (p *PasswordPolicy) Check(pw string, user *types.User) []string {
+	var problems []string
+
+	if n := len([]rune(pw)); n < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+	if p.MaxBytes > 0 && len(pw) > p.MaxBytes {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes", p.MaxBytes))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range pw {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		problems = append(problems, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		problems = append(problems, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		problems = append(problems, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		problems = append(problems, "must contain a symbol")
+	}
+
+	lowerPW := strings.ToLower(pw)
+	if p.RejectPersonal && user != nil {
+		local, _, _ := strings.Cut(user.Email, "@")
+		for _, part := range []string{local, user.FirstName, user.LastName} {
+			part = strings.ToLower(strings.TrimSpace(part))
+			if len(part) >= 3 && strings.Contains(lowerPW, part) {
+				problems = append(problems, "must not contain your email or name")
+				break
+			}
+		}
+	}
+	if p.RejectCommon && commonPasswords[lowerPW] {
+		problems = append(problems, "is too common")
+	}
+
+	return problems
+}
+
+// CheckPassword applies the configured policy.
+func CheckPassword(pw string, user *types.User) []string {
+	return defaultPolicy.Check(pw, user)
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	strict := &PasswordPolicy{
+		MinLength:      8,
+		MaxBytes:       72,
+		RequireUpper:   true,
+		RequireLower:   true,
+		RequireDigit:   true,
+		RequireSymbol:  true,
+		RejectPersonal: true,
+		RejectCommon:   true,
+	}
+	lenient := &PasswordPolicy{MinLength: 4, RejectCommon: true}
+	user := &types.User{Email: "ada.lovelace@example.com", FirstName: "Ada", LastName: "Lovelace"}
+
+	tests := []struct {
+		name   string
+		policy *PasswordPolicy
+		pw     string
+		user   *types.User
+		want   []string
+	}{
+		{name: "acceptable", policy: strict, pw: "Tr0ub4dor&3", user: user},
+		{name: "too short", policy: strict, pw: "Ab1!", want: []string{"must be at least 8 characters"}},
+		{name: "length counts characters, not bytes", policy: strict, pw: "Äbcdé1!", want: []string{"must be at least 8 characters"}},
+		{name: "too long", policy: strict, pw: "Aa1!" + strings.Repeat("x", 69), want: []string{"must be at most 72 bytes"}},
+		{name: "no uppercase", policy: strict, pw: "tr0ub4dor&3", want: []string{"must contain an uppercase letter"}},
+		{name: "no lowercase", policy: strict, pw: "TR0UB4DOR&3", want: []string{"must contain a lowercase letter"}},
+		{name: "no digit", policy: strict, pw: "Troubador&x", want: []string{"must contain a digit"}},
+		{name: "no symbol", policy: strict, pw: "Tr0ub4dor33", want: []string{"must contain a symbol"}},
+		{name: "space is a symbol", policy: strict, pw: "Tr0ub4dor 3"},
+		{name: "every class missing", policy: strict, pw: "        ", want: []string{
+			"must contain an uppercase letter", "must contain a lowercase letter", "must contain a digit",
+		}},
+		{name: "contains email", policy: strict, pw: "Ada.Lovelace1!", user: user, want: []string{"must not contain your email or name"}},
+		{name: "contains last name", policy: strict, pw: "xLOVELACEx1!", user: user, want: []string{"must not contain your email or name"}},
+		{name: "short name parts are ignored", policy: strict, pw: "Adamant1um!", user: &types.User{Email: "jo@example.com", FirstName: "Jo"}},
+		{name: "no user", policy: strict, pw: "Ada.Lovelace1!"},
+		{name: "common", policy: lenient, pw: "password1", want: []string{"is too common"}},
+		{name: "common in any case", policy: lenient, pw: "QWERTY123", want: []string{"is too common"}},
+		{name: "common check disabled", policy: &PasswordPolicy{MinLength: 4}, pw: "password1"},
+		{name: "all problems reported", policy: strict, pw: "password", want: []string{
+			"must contain an uppercase letter", "must contain a digit", "must contain a symbol", "is too common",
+		}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.Check(tt.pw, tt.user); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Check(%q) = %q, want %q", tt.name, tt.pw, got, tt.want)
+		}
+	}
+}
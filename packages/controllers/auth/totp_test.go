@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of RFC 6238 appendix B, "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B, truncated to our six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfc6238Secret, tt.code, time.Unix(tt.unix, 0), 0)
+		if !ok || step != tt.unix/totpPeriod {
+			t.Errorf("T=%d code %s: got step %d, %v", tt.unix, tt.code, step, ok)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// 1111111111 is in step 37037037, whose code is 050471
+	at := func(step int64) time.Time { return time.Unix(step*totpPeriod+5, 0) }
+	const step = 37037037
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		now      time.Time
+		lastStep int64
+		ok       bool
+	}{
+		{name: "current step", secret: rfc6238Secret, code: "050471", now: at(step), ok: true},
+		{name: "lower-case secret and spaces", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", code: " 050471 ", now: at(step), ok: true},
+		{name: "clock one step behind", secret: rfc6238Secret, code: "050471", now: at(step - 1), ok: true},
+		{name: "clock one step ahead", secret: rfc6238Secret, code: "050471", now: at(step + 1), ok: true},
+		{name: "outside the skew window", secret: rfc6238Secret, code: "050471", now: at(step + 2)},
+		{name: "outside the skew window behind", secret: rfc6238Secret, code: "050471", now: at(step - 2)},
+		{name: "replayed", secret: rfc6238Secret, code: "050471", now: at(step), lastStep: step},
+		{name: "older than last use", secret: rfc6238Secret, code: "050471", now: at(step + 1), lastStep: step},
+		{name: "wrong code", secret: rfc6238Secret, code: "050472", now: at(step)},
+		{name: "wrong length", secret: rfc6238Secret, code: "50471", now: at(step)},
+		{name: "invalid secret", secret: "not base32!", code: "050471", now: at(step)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ValidateTOTP(tt.secret, tt.code, tt.now, tt.lastStep)
+			if ok != tt.ok {
+				t.Fatalf("ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && got != step {
+				t.Errorf("step = %d, want %d", got, step)
+			}
+		})
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := b32.DecodeString(secret)
+	if err != nil || len(key) != secretBytes {
+		t.Fatalf("secret %q decodes to %d bytes, %v", secret, len(key), err)
+	}
+
+	code := totpCode(key, uint64(time.Now().Unix()/totpPeriod))
+	if _, ok := ValidateTOTP(secret, code, time.Now(), 0); !ok {
+		t.Errorf("code %s for a generated secret was rejected", code)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	format := regexp.MustCompile(`^[a-z2-7]{5}-[a-z2-7]{5}$`)
+	seen := map[string]bool{}
+	for _, c := range codes {
+		if !format.MatchString(c) {
+			t.Errorf("code %q is not in the form xxxxx-xxxxx", c)
+		}
+		if seen[HashRecoveryCode(c)] {
+			t.Errorf("code %q was generated twice", c)
+		}
+		seen[HashRecoveryCode(c)] = true
+	}
+
+	// codes are typed by hand, so case, dashes and spaces do not matter
+	want := HashRecoveryCode("abcde-fghij")
+	for _, typed := range []string{"ABCDE-FGHIJ", "abcdefghij", " abcde fghij "} {
+		if got := HashRecoveryCode(typed); got != want {
+			t.Errorf("HashRecoveryCode(%q) differs from the generated form", typed)
+		}
+	}
+	if HashRecoveryCode("abcde-fghik") == want {
+		t.Error("different codes hash the same")
+	}
+}
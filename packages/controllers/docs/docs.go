@@ -0,0 +1,65 @@
+package docs
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/gorilla/mux"
+)
+
+// Spec is the OpenAPI 3 description of the API. It is written by hand and
+// kept in sync with the router by the drift test in packages/routes.
+//
+//go:embed openapi.json
+var Spec []byte
+
+//go:embed ui
+var ui embed.FS
+
+// docsCSP relaxes the API-wide policy just enough for the docs page to load
+// its own script and stylesheet and fetch the spec.
+const docsCSP = "default-src 'none'; script-src 'self'; style-src 'self'; connect-src 'self'; img-src 'self' data:; frame-ancestors 'none'; base-uri 'none'; form-action 'none'"
+
+type DocsService struct {
+	assets http.Handler
+}
+
+func NewDocsService() *DocsService {
+	files, err := fs.Sub(ui, "ui")
+	if err != nil {
+		panic(err)
+	}
+
+	return &DocsService{assets: http.StripPrefix("/docs/", http.FileServer(http.FS(files)))}
+}
+
+func (s *DocsService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/openapi.json", s.handleSpec).Methods("GET")
+	r.HandleFunc("/docs", s.handleUI).Methods("GET")
+	r.PathPrefix("/docs/").HandlerFunc(s.handleAsset).Methods("GET")
+}
+
+func (s *DocsService) handleSpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(Spec)
+}
+
+func (s *DocsService) handleUI(w http.ResponseWriter, r *http.Request) {
+	page, err := ui.ReadFile("ui/index.html")
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal(err))
+		return
+	}
+
+	w.Header().Set("Content-Security-Policy", docsCSP)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+func (s *DocsService) handleAsset(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", docsCSP)
+	s.assets.ServeHTTP(w, r)
+}
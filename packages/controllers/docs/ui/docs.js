@@ -0,0 +1,106 @@
+"use strict";
+
+(function () {
+  var spec;
+
+  function el(tag, attrs, children) {
+    var node = document.createElement(tag);
+    Object.keys(attrs || {}).forEach(function (k) { node.setAttribute(k, attrs[k]); });
+    (children || []).forEach(function (c) {
+      node.appendChild(typeof c === "string" ? document.createTextNode(c) : c);
+    });
+    return node;
+  }
+
+  // resolve expands local $refs so the rendered schemas are self-contained.
+  function resolve(schema, seen) {
+    seen = seen || [];
+    if (Array.isArray(schema)) return schema.map(function (s) { return resolve(s, seen); });
+    if (!schema || typeof schema !== "object") return schema;
+    if (schema.$ref) {
+      if (seen.indexOf(schema.$ref) >= 0) return { $ref: schema.$ref };
+      var target = schema.$ref.replace(/^#\//, "").split("/").reduce(function (o, k) { return o[k]; }, spec);
+      return resolve(target, seen.concat(schema.$ref));
+    }
+    var out = {};
+    Object.keys(schema).forEach(function (k) { out[k] = resolve(schema[k], seen); });
+    return out;
+  }
+
+  function schemaBlock(content) {
+    var media = content && content["application/json"];
+    if (!media || !media.schema) return null;
+    return el("pre", {}, [JSON.stringify(resolve(media.schema), null, 2)]);
+  }
+
+  function operation(path, method, op) {
+    var body = el("div", { class: "body" });
+    if (op.description) body.appendChild(el("p", {}, [op.description]));
+
+    if (op.parameters && op.parameters.length) {
+      var rows = op.parameters.map(function (p) {
+        return el("tr", {}, [
+          el("td", {}, [el("code", {}, [p.name])]),
+          el("td", {}, [p.in]),
+          el("td", {}, [p.required ? "required" : "optional"]),
+          el("td", {}, [p.description || ""]),
+        ]);
+      });
+      body.appendChild(el("h4", {}, ["Parameters"]));
+      body.appendChild(el("table", {}, rows));
+    }
+
+    if (op.requestBody) {
+      body.appendChild(el("h4", {}, ["Request body"]));
+      var req = schemaBlock(op.requestBody.content);
+      if (req) body.appendChild(req);
+    }
+
+    body.appendChild(el("h4", {}, ["Responses"]));
+    Object.keys(op.responses || {}).forEach(function (code) {
+      var r = op.responses[code];
+      body.appendChild(el("p", {}, [el("strong", {}, [code]), " " + r.description]));
+      var res = schemaBlock(r.content);
+      if (res) body.appendChild(res);
+    });
+
+    var summary = el("summary", {}, [
+      el("span", { class: "method " + method }, [method]),
+      el("span", { class: "path" + (op.security ? " secured" : "") + (op.deprecated ? " deprecated" : "") }, [path]),
+      el("span", {}, [op.summary || ""]),
+    ]);
+    return el("details", {}, [summary, body]);
+  }
+
+  function render() {
+    document.title = spec.info.title + " documentation";
+    document.getElementById("title").textContent = spec.info.title + " " + spec.info.version;
+    document.getElementById("description").textContent = spec.info.description || "";
+
+    var groups = {};
+    var order = (spec.tags || []).map(function (t) { return t.name; });
+    Object.keys(spec.paths).forEach(function (path) {
+      Object.keys(spec.paths[path]).forEach(function (method) {
+        var op = spec.paths[path][method];
+        var tag = (op.tags && op.tags[0]) || "Other";
+        if (order.indexOf(tag) < 0) order.push(tag);
+        (groups[tag] = groups[tag] || []).push(operation(path, method, op));
+      });
+    });
+
+    var main = document.getElementById("operations");
+    main.textContent = "";
+    order.forEach(function (tag) {
+      if (!groups[tag]) return;
+      main.appendChild(el("h2", {}, [tag]));
+      groups[tag].forEach(function (node) { main.appendChild(node); });
+    });
+  }
+
+  fetch("/openapi.json")
+    .then(function (res) { return res.json(); })
+    .then(function (doc) { spec = doc; render(); })
+    .catch(function (err) {
+      document.getElementById("operations").textContent = "Could not load the API description: " + err;
+    });
+})();
@@ -0,0 +1,106 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/logging"
+	"github.com/AriJaya07/go-rest-api/packages/models/store"
+	"github.com/AriJaya07/go-rest-api/packages/utils"
+	"github.com/gorilla/mux"
+)
+
+const checkTimeout = 2 * time.Second
+
+type HealthService struct {
+	store         store.Store
+	schemaVersion int
+	shuttingDown  atomic.Bool
+}
+
+// checkResult is served to unauthenticated callers, so errors from the
+// store are logged and replaced with a generic message.
+type checkResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// NewHealthService reports ready only once the database schema is at
+// schemaVersion, the latest migration this binary knows about.
+func NewHealthService(s store.Store, schemaVersion int) *HealthService {
+	return &HealthService{store: s, schemaVersion: schemaVersion}
+}
+
+func (s *HealthService) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/healthz", s.handleLiveness).Methods("GET")
+	r.HandleFunc("/readyz", s.handleReadiness).Methods("GET")
+}
+
+// SetShuttingDown makes readiness fail so load balancers stop sending new
+// traffic while in-flight requests drain.
+func (s *HealthService) SetShuttingDown() {
+	s.shuttingDown.Store(true)
+}
+
+func (s *HealthService) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+func (s *HealthService) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+
+	checks := map[string]checkResult{
+		"database":   s.checkDatabase(ctx),
+		"migrations": s.checkMigrations(ctx),
+		"shutdown":   s.checkShutdown(),
+	}
+
+	status, code := "ok", http.StatusOK
+	for _, c := range checks {
+		if c.Status != "ok" {
+			status, code = "fail", http.StatusServiceUnavailable
+		}
+	}
+
+	utils.WriteJSON(w, code, healthResponse{Status: status, Checks: checks})
+}
+
+func (s *HealthService) checkDatabase(ctx context.Context) checkResult {
+	if err := s.store.Ping(ctx); err != nil {
+		logging.FromContext(ctx).Error("database check failed", slog.Any("error", err))
+		return checkResult{Status: "fail", Error: "database unreachable"}
+	}
+
+	return checkResult{Status: "ok"}
+}
+
+func (s *HealthService) checkMigrations(ctx context.Context) checkResult {
+	version, err := s.store.SchemaVersion(ctx)
+	if err != nil {
+		logging.FromContext(ctx).Error("migrations check failed", slog.Any("error", err))
+		return checkResult{Status: "fail", Error: "schema version unavailable"}
+	}
+	if version < s.schemaVersion {
+		return checkResult{Status: "fail", Error: fmt.Sprintf("schema version %d, want %d", version, s.schemaVersion)}
+	}
+
+	return checkResult{Status: "ok"}
+}
+
+func (s *HealthService) checkShutdown() checkResult {
+	if s.shuttingDown.Load() {
+		return checkResult{Status: "fail", Error: "shutting down"}
+	}
+
+	return checkResult{Status: "ok"}
+}
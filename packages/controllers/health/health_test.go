@@ -0,0 +1,89 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/models/store"
+	"github.com/gorilla/mux"
+)
+
+type fakeStore struct {
+	store.Store
+	pingErr    error
+	version    int
+	versionErr error
+}
+
+func (s *fakeStore) Ping(ctx context.Context) error { return s.pingErr }
+
+func (s *fakeStore) SchemaVersion(ctx context.Context) (int, error) {
+	return s.version, s.versionErr
+}
+
+func TestReadiness(t *testing.T) {
+	secret := errors.New("dial tcp db.internal:3306: access denied for user 'app'@'10.0.0.7'")
+
+	tests := []struct {
+		name     string
+		store    *fakeStore
+		shutdown bool
+		status   int
+		checks   map[string]checkResult
+	}{
+		{name: "ready", store: &fakeStore{version: 3}, status: http.StatusOK, checks: map[string]checkResult{
+			"database": {Status: "ok"}, "migrations": {Status: "ok"}, "shutdown": {Status: "ok"},
+		}},
+		{name: "database down", store: &fakeStore{pingErr: secret, versionErr: secret}, status: http.StatusServiceUnavailable,
+			checks: map[string]checkResult{
+				"database":   {Status: "fail", Error: "database unreachable"},
+				"migrations": {Status: "fail", Error: "schema version unavailable"},
+				"shutdown":   {Status: "ok"},
+			}},
+		{name: "schema behind", store: &fakeStore{version: 2}, status: http.StatusServiceUnavailable,
+			checks: map[string]checkResult{
+				"database":   {Status: "ok"},
+				"migrations": {Status: "fail", Error: "schema version 2, want 3"},
+				"shutdown":   {Status: "ok"},
+			}},
+		{name: "shutting down", store: &fakeStore{version: 3}, shutdown: true, status: http.StatusServiceUnavailable,
+			checks: map[string]checkResult{
+				"database": {Status: "ok"}, "migrations": {Status: "ok"}, "shutdown": {Status: "fail", Error: "shutting down"},
+			}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewHealthService(tt.store, 3)
+			if tt.shutdown {
+				s.SetShuttingDown()
+			}
+			router := mux.NewRouter()
+			s.RegisterRoutes(router)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if strings.Contains(w.Body.String(), "db.internal") {
+				t.Errorf("store error leaked into the response: %s", w.Body)
+			}
+			var resp healthResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			for name, want := range tt.checks {
+				if got := resp.Checks[name]; got != want {
+					t.Errorf("%s = %+v, want %+v", name, got, want)
+				}
+			}
+		})
+	}
+}
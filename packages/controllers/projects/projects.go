@@ -1,17 +1,21 @@
 package projects
 
 import (
-	"encoding/json"
-	"io"
 	"net/http"
 
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
 	"github.com/AriJaya07/go-rest-api/packages/controllers/auth"
 	"github.com/AriJaya07/go-rest-api/packages/models/store"
 	"github.com/AriJaya07/go-rest-api/packages/models/types"
+	"github.com/AriJaya07/go-rest-api/packages/pagination"
 	"github.com/AriJaya07/go-rest-api/packages/utils"
+	"github.com/AriJaya07/go-rest-api/packages/validation"
 	"github.com/gorilla/mux"
 )
 
+// projectReadOnly are the project members a PATCH may not change.
+var projectReadOnly = []string{"id", "version", "createdAt", "updatedAt"}
+
 type ProjectService struct {
 	store store.Store
 }
@@ -28,43 +32,73 @@ func (s *ProjectService) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/projects/delete/{id}", auth.WithJWTAuth(s.handleDeleteProject, s.store)).Methods("DELETE")
 }
 
+// RegisterRoutesV2 mounts the resource-oriented routes.
+func (s *ProjectService) RegisterRoutesV2(r *mux.Router) {
+	r.HandleFunc("/projects", auth.WithJWTAuth(s.handleGetAllProject, s.store)).Methods("GET")
+	r.HandleFunc("/projects", auth.WithJWTAuth(s.handleCreateProjectV2, s.store)).Methods("POST")
+	r.HandleFunc("/projects/{id}", auth.WithJWTAuth(s.handleGetProject, s.store)).Methods("GET")
+	r.HandleFunc("/projects/{id}", auth.WithJWTAuth(s.handleUpdateProjectV2, s.store)).Methods("PATCH")
+	r.HandleFunc("/projects/{id}", auth.WithJWTAuth(s.handleDeleteProject, s.store)).Methods("DELETE")
+}
+
 func (s *ProjectService) handleCreateProject(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+	project, err := s.createProject(w, r)
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	defer r.Body.Close()
+	utils.WriteJSON(w, http.StatusCreated, project)
+}
 
-	var project *types.Project
-	err = json.Unmarshal(body, &project)
+func (s *ProjectService) handleCreateProjectV2(w http.ResponseWriter, r *http.Request) {
+	project, err := s.createProject(w, r)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: "Invalid request payload"})
+		apierror.Write(w, r, err)
 		return
 	}
 
-	if project.Name == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: "Name is required"})
-		return
+	utils.WriteCreated(w, r, project.ID, project)
+}
+
+func (s *ProjectService) createProject(w http.ResponseWriter, r *http.Request) (*types.Project, error) {
+	var input types.CreateProjectPayload
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		return nil, err
 	}
 
-	err = s.store.CreateProject(project)
-	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Error creating project"})
-		return
+	project := &types.Project{Name: input.Name}
+	if err := validation.Struct(r.Context(), project); err != nil {
+		return nil, err
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, project)
+	if err := s.store.CreateProject(r.Context(), project); err != nil {
+		return nil, err
+	}
+
+	return project, nil
 }
 
 func (s *ProjectService) handleGetAllProject(w http.ResponseWriter, r *http.Request) {
-	projects, err := s.store.GetAllProjects()
+	q := pagination.NewQuery(r)
+	filter := types.ProjectFilter{
+		Name:          q.String("name"),
+		CreatedAfter:  q.Time("createdAfter"),
+		CreatedBefore: q.Time("createdBefore"),
+	}
+	opts := q.ListOptions()
+	if err := q.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	projects, next, err := s.store.ListProjects(r.Context(), filter, opts)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Error getting all project"})
+		apierror.Write(w, r, err)
 		return
 	}
 
+	pagination.SetNext(w, r, next)
 	utils.WriteJSON(w, http.StatusOK, projects)
 }
 
@@ -72,54 +106,109 @@ func (s *ProjectService) handleGetProject(w http.ResponseWriter, r *http.Request
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	project, err := s.store.GetProject(id)
+	project, err := s.store.GetProject(r.Context(), id)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Error getting project"})
+		apierror.Write(w, r, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, project)
+	utils.WriteVersioned(w, r, project.Version, project)
 }
 
 func (s *ProjectService) handleUpdateProject(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.updateProject(w, r); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Project updated successfully"})
+}
+
+// handleUpdateProjectV2 applies a merge patch or JSON Patch to the project
+// and responds with the result.
+func (s *ProjectService) handleUpdateProjectV2(w http.ResponseWriter, r *http.Request) {
+	project, err := s.patchProject(w, r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	utils.WriteVersioned(w, r, project.Version, project)
+}
+
+func (s *ProjectService) patchProject(w http.ResponseWriter, r *http.Request) (*types.Project, error) {
+	project, err := s.store.GetProject(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.CheckIfMatch(r, project.Version); err != nil {
+		return nil, err
+	}
+
+	if err := utils.DecodePatch(w, r, project, projectReadOnly...); err != nil {
+		return nil, err
+	}
+	if err := validation.Struct(r.Context(), project); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.UpdateProject(r.Context(), project); err != nil {
+		return nil, err
+	}
+
+	return project, nil
+}
+
+func (s *ProjectService) updateProject(w http.ResponseWriter, r *http.Request) (*types.Project, error) {
 	idStr := mux.Vars(r)["id"]
 
 	var input types.UpdateProject
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: "Invalid request payload"})
-		return
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		return nil, err
+	}
+
+	if err := validation.Struct(r.Context(), &input); err != nil {
+		return nil, err
 	}
-	defer r.Body.Close()
 
-	// Fetch user from store
-	project, err := s.store.GetProject(idStr)
+	// Fetch project from store
+	project, err := s.store.GetProject(r.Context(), idStr)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Failed to fetch project"})
-		return
+		return nil, err
+	}
+	if err := utils.CheckIfMatch(r, project.Version); err != nil {
+		return nil, err
 	}
 
 	if input.Name != "" {
 		project.Name = input.Name
 	}
 
-	if err := s.store.UpdateProject(project); err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Failed to update project"})
-		return
+	if err := s.store.UpdateProject(r.Context(), project); err != nil {
+		return nil, err
 	}
 
-	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Project updated successfully"})
-
+	return project, nil
 }
 
 func (s *ProjectService) handleDeleteProject(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	err := s.store.DeleteProject(id)
+	project, err := s.store.GetProject(r.Context(), id)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Error deleting project"})
+		apierror.Write(w, r, err)
+		return
+	}
+	if err := utils.CheckIfMatch(r, project.Version); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := s.store.DeleteProject(r.Context(), id, project.Version); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusNoContent, nil)
+	w.WriteHeader(http.StatusNoContent)
 }
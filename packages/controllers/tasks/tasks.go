@@ -1,28 +1,40 @@
 package tasks
 
 import (
-	"encoding/json"
-	"errors"
-	"io"
+	"context"
 	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
 	"github.com/AriJaya07/go-rest-api/packages/controllers/auth"
+	"github.com/AriJaya07/go-rest-api/packages/metrics"
 	"github.com/AriJaya07/go-rest-api/packages/models/store"
 	"github.com/AriJaya07/go-rest-api/packages/models/types"
+	"github.com/AriJaya07/go-rest-api/packages/pagination"
 	"github.com/AriJaya07/go-rest-api/packages/utils"
+	"github.com/AriJaya07/go-rest-api/packages/validation"
 	"github.com/gorilla/mux"
 )
 
-var errNameRequired = errors.New("name is required")
-var errProjectIDRequired = errors.New("project id is required")
-var errUserIDRequired = errors.New("user id is required")
+// taskReadOnly are the task members a PATCH may not change. A task stays in
+// the project it was created in.
+var taskReadOnly = []string{"id", "projectId", "version", "createdAt", "updatedAt"}
 
 type TasksService struct {
-	store store.Store
+	store     store.Store
+	validator *validation.Validator
 }
 
 func NewTasksService(s store.Store) *TasksService {
-	return &TasksService{store: s}
+	service := &TasksService{store: s, validator: validation.New()}
+	service.validator.Register("taskstatus", validTaskStatus)
+	service.validator.Register("projectexists", service.projectExists)
+	service.validator.Register("userexists", service.userExists)
+
+	return service
 }
 
 func (s *TasksService) RegisterRoutes(r *mux.Router) {
@@ -30,36 +42,46 @@ func (s *TasksService) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/tasks/${id}", auth.WithJWTAuth(s.handleGetTask, s.store)).Methods("GET")
 }
 
+// RegisterRoutesV2 mounts tasks under the project they belong to.
+func (s *TasksService) RegisterRoutesV2(r *mux.Router) {
+	r.HandleFunc("/tasks", auth.WithJWTAuth(s.handleGetTasks, s.store)).Methods("GET")
+	r.HandleFunc("/projects/{id}/tasks", auth.WithJWTAuth(s.handleGetProjectTasks, s.store)).Methods("GET")
+	r.HandleFunc("/projects/{id}/tasks", auth.WithJWTAuth(s.handleCreateProjectTask, s.store)).Methods("POST")
+	r.HandleFunc("/projects/{id}/tasks/{taskId}", auth.WithJWTAuth(s.handleGetProjectTask, s.store)).Methods("GET")
+	r.HandleFunc("/projects/{id}/tasks/{taskId}", auth.WithJWTAuth(s.handleUpdateProjectTask, s.store)).Methods("PATCH")
+}
+
 func (s *TasksService) handleCreateTask(w http.ResponseWriter, r *http.Request) {
-	// Read request body
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: "Failed to read request body"})
+	// Decode the JSON payload into the task variable
+	var input types.CreateTaskPayLoad
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
-	defer r.Body.Close()
-
-	// Declare a variable of type Task
-	var task types.Task
 
-	// Unmarshal JSON payload into the task variable
-	if err := json.Unmarshal(body, &task); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: "Invalid JSON format"})
-		return
+	task := types.Task{
+		Name:         input.Name,
+		Status:       input.Status,
+		ProjectId:    input.ProjectID,
+		AssignedToID: input.AssignedToID,
 	}
 
 	// Validate task payload
-	if err := validateTaskPayload(&task); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: err.Error()})
+	if err := s.validator.Struct(r.Context(), &task); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
+	if task.Status == "" {
+		task.Status = types.TaskStatusTodo
+	}
 
 	// Create task in the store
-	createdTask, err := s.store.CreateTask(&task)
+	createdTask, err := s.store.CreateTask(r.Context(), &task)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Failed to create task"})
+		apierror.Write(w, r, err)
 		return
 	}
+	metrics.TasksCreated.Inc()
 
 	// Respond with the created task
 	utils.WriteJSON(w, http.StatusCreated, createdTask)
@@ -74,27 +96,186 @@ func (s *TasksService) handleGetTask(w http.ResponseWriter, r *http.Request) {
 	// 	return
 	// }
 
-	t, err := s.store.GetTask(id)
+	t, err := s.store.GetTask(r.Context(), id)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	utils.WriteVersioned(w, r, t.Version, t)
+}
+
+func (s *TasksService) handleGetTasks(w http.ResponseWriter, r *http.Request) {
+	q := pagination.NewQuery(r)
+	filter := taskFilter(q)
+	filter.ProjectID = q.ID("projectId")
+
+	s.listTasks(w, r, q, filter)
+}
+
+func (s *TasksService) handleGetProjectTasks(w http.ResponseWriter, r *http.Request) {
+	project, err := s.store.GetProject(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	q := pagination.NewQuery(r)
+	filter := taskFilter(q)
+	filter.ProjectID = project.ID
+
+	s.listTasks(w, r, q, filter)
+}
+
+// taskFilter reads the filters both task lists accept.
+func taskFilter(q *pagination.Query) types.TaskFilter {
+	return types.TaskFilter{
+		Name:          q.String("name"),
+		Status:        q.OneOf("status", types.TaskStatuses),
+		AssignedToID:  q.ID("assignedToID"),
+		CreatedAfter:  q.Time("createdAfter"),
+		CreatedBefore: q.Time("createdBefore"),
+	}
+}
+
+func (s *TasksService) listTasks(w http.ResponseWriter, r *http.Request, q *pagination.Query, filter types.TaskFilter) {
+	opts := q.ListOptions()
+	if err := q.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	tasks, next, err := s.store.ListTasks(r.Context(), filter, opts)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "task not found!"})
+		apierror.Write(w, r, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, t)
+	pagination.SetNext(w, r, next)
+	utils.WriteJSON(w, http.StatusOK, tasks)
 }
 
-func validateTaskPayload(task *types.Task) error {
-	if task.Name == "" {
-		return errNameRequired
+func (s *TasksService) handleCreateProjectTask(w http.ResponseWriter, r *http.Request) {
+	project, err := s.store.GetProject(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
 	}
 
-	if task.ProjectId == 0 {
-		return errProjectIDRequired
+	var input types.ProjectTaskRequest
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		apierror.Write(w, r, err)
+		return
 	}
 
-	if task.AssignedToID == 0 {
-		return errUserIDRequired
+	task := types.Task{
+		Name:         input.Name,
+		Status:       input.Status,
+		ProjectId:    project.ID,
+		AssignedToID: input.AssignedToID,
 	}
+	if err := s.validator.Struct(r.Context(), &task); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if task.Status == "" {
+		task.Status = types.TaskStatusTodo
+	}
+
+	createdTask, err := s.store.CreateTask(r.Context(), &task)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	metrics.TasksCreated.Inc()
 
-	return nil
+	utils.WriteCreated(w, r, createdTask.ID, createdTask)
+}
+
+func (s *TasksService) handleGetProjectTask(w http.ResponseWriter, r *http.Request) {
+	t, err := s.projectTask(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	utils.WriteVersioned(w, r, t.Version, t)
+}
+
+// handleUpdateProjectTask applies a merge patch or JSON Patch to the task
+// and responds with the result.
+func (s *TasksService) handleUpdateProjectTask(w http.ResponseWriter, r *http.Request) {
+	t, err := s.projectTask(r)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if err := utils.CheckIfMatch(r, t.Version); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := utils.DecodePatch(w, r, t, taskReadOnly...); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if err := s.validator.Struct(r.Context(), t); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := s.store.UpdateTask(r.Context(), t); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	utils.WriteVersioned(w, r, t.Version, t)
+}
+
+// projectTask looks up the task in the URL under the project in the URL.
+func (s *TasksService) projectTask(r *http.Request) (*types.Task, error) {
+	vars := mux.Vars(r)
+
+	project, err := s.store.GetProject(r.Context(), vars["id"])
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := s.store.GetTask(r.Context(), vars["taskId"])
+	if err != nil {
+		return nil, err
+	}
+	// a task is only found under its own project
+	if t.ProjectId != project.ID {
+		return nil, apierror.NotFound("task_not_found", "Task not found")
+	}
+
+	return t, nil
+}
+
+func validTaskStatus(_ context.Context, v reflect.Value, _ string) (string, error) {
+	if slices.Contains(types.TaskStatuses, v.String()) {
+		return "", nil
+	}
+	return "must be one of: " + strings.Join(types.TaskStatuses, ", "), nil
+}
+
+func (s *TasksService) projectExists(ctx context.Context, v reflect.Value, _ string) (string, error) {
+	_, err := s.store.GetProject(ctx, strconv.FormatInt(v.Int(), 10))
+	return existence("project", err)
+}
+
+func (s *TasksService) userExists(ctx context.Context, v reflect.Value, _ string) (string, error) {
+	_, err := s.store.GetUserByID(ctx, strconv.FormatInt(v.Int(), 10))
+	return existence("user", err)
+}
+
+func existence(resource string, err error) (string, error) {
+	if err == nil {
+		return "", nil
+	}
+	if apierror.KindOf(err) == apierror.KindNotFound {
+		return resource + " does not exist", nil
+	}
+	return "", err
 }
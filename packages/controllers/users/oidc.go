@@ -0,0 +1,175 @@
+package users
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/auth"
+	"github.com/AriJaya07/go-rest-api/packages/logging"
+	"github.com/AriJaya07/go-rest-api/packages/metrics"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+	"github.com/AriJaya07/go-rest-api/packages/utils"
+)
+
+const oidcStateCookie = "oidc_state"
+
+func (s *UserService) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	req, err := auth.NewOIDCAuthRequest()
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal(err))
+		return
+	}
+
+	redirect, err := s.oidc.AuthCodeURL(req)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("oidc discovery failed", slog.Any("error", err))
+		apierror.Write(w, r, apierror.New(apierror.KindBadGateway, "identity_provider_unavailable", "Identity provider unavailable").Wrap(err))
+		return
+	}
+
+	state, err := auth.CreateOIDCStateToken([]byte(config.Envs.JWTSecret), req)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal(err))
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/",
+		Expires:  time.Now().Add(10 * time.Minute),
+		HttpOnly: true,
+		Secure:   config.Envs.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+func (s *UserService) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		apierror.Write(w, r, apierror.Unauthorized("login_failed", "Login failed: "+e))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid_login_state", "Missing login state"))
+		return
+	}
+
+	// the state cookie is single use
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true, Secure: config.Envs.CookieSecure})
+
+	req, err := auth.ParseOIDCStateToken(cookie.Value)
+	if err != nil || req.State == "" || req.State != q.Get("state") {
+		apierror.Write(w, r, apierror.BadRequest("invalid_login_state", "Invalid login state"))
+		return
+	}
+
+	identity, err := s.oidc.Exchange(q.Get("code"), req)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("oidc code exchange failed", slog.Any("error", err))
+		apierror.Write(w, r, apierror.Unauthorized("login_failed", "Login failed"))
+		return
+	}
+
+	user, err := s.resolveOIDCUser(r.Context(), identity)
+	if err != nil {
+		logging.FromContext(r.Context()).Warn("oidc user resolution failed", slog.Any("error", err))
+		apierror.Write(w, r, err)
+		return
+	}
+
+	enabled, err := s.twoFactorEnabled(r.Context(), user.ID)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal(err))
+		return
+	}
+	if enabled {
+		challenge, err := auth.CreateLoginChallenge([]byte(config.Envs.JWTSecret), user.ID)
+		if err != nil {
+			apierror.Write(w, r, apierror.Internal(err))
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, types.LoginChallengeResponse{TwoFactorRequired: true, Challenge: challenge})
+		return
+	}
+
+	token, err := createAndSetAuthCookie(user.ID, user.Email, w)
+	if err != nil {
+		apierror.Write(w, r, apierror.Internal(err))
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.LoginResponse{Email: user.Email, Token: token})
+}
+
+// resolveOIDCUser returns the local user for an external identity. An
+// identity seen before maps to its linked user; otherwise the identity is
+// linked to the user with the same verified email, or a new user is created.
+func (s *UserService) resolveOIDCUser(ctx context.Context, id *auth.OIDCIdentity) (*types.User, error) {
+	user, err := s.store.GetUserByIdentity(ctx, id.Issuer, id.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if apierror.KindOf(err) != apierror.KindNotFound {
+		return nil, err
+	}
+
+	if id.Email == "" || !id.EmailVerified {
+		return nil, errEmailNotVerified
+	}
+
+	user, err = s.store.GetUserByEmail(ctx, id.Email)
+	if apierror.KindOf(err) == apierror.KindNotFound {
+		user, err = s.provisionOIDCUser(ctx, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.LinkIdentity(ctx, user.ID, id.Issuer, id.Subject); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *UserService) provisionOIDCUser(ctx context.Context, id *auth.OIDCIdentity) (*types.User, error) {
+	// the account has no usable local password until one is set by a reset
+	random, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	hashedPW, err := auth.HashPassword(random)
+	if err != nil {
+		return nil, err
+	}
+
+	firstName := id.GivenName
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(id.Email, "@")
+	}
+
+	user, err := s.store.CreateUser(ctx, &types.User{
+		Email:     id.Email,
+		FirstName: firstName,
+		LastName:  id.FamilyName,
+		Password:  hashedPW,
+		Role:      types.RoleUser,
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.UsersRegistered.Inc()
+
+	return user, nil
+}
@@ -0,0 +1,108 @@
+package users
+
+import (
+	"context"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/auth"
+	"github.com/AriJaya07/go-rest-api/packages/models/store/storetest"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+func TestResolveOIDCUser(t *testing.T) {
+	const issuer = "https://issuer.example.com"
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		identity auth.OIDCIdentity
+		// wantUser is the email of the user the identity resolves to
+		wantUser string
+		users    int // afterwards
+		code     string
+	}{
+		{name: "linked identity", identity: auth.OIDCIdentity{Subject: "linked", Email: "other@example.com"},
+			wantUser: "linked@example.com", users: 2},
+		{name: "links existing user by verified email", identity: auth.OIDCIdentity{Subject: "new", Email: "Existing@example.com", EmailVerified: true},
+			wantUser: "existing@example.com", users: 2},
+		{name: "provisions new user", identity: auth.OIDCIdentity{Subject: "new", Email: "new@example.com", EmailVerified: true, GivenName: "New", FamilyName: "User"},
+			wantUser: "new@example.com", users: 3},
+		{name: "unverified email is not linked", identity: auth.OIDCIdentity{Subject: "new", Email: "existing@example.com"},
+			users: 2, code: "email_not_verified"},
+		{name: "no email", identity: auth.OIDCIdentity{Subject: "new", EmailVerified: true},
+			users: 2, code: "email_not_verified"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := storetest.NewMemory()
+			linked, _ := mem.CreateUser(ctx, &types.User{Email: "linked@example.com", Role: types.RoleUser})
+			mem.CreateUser(ctx, &types.User{Email: "existing@example.com", Role: types.RoleAdmin})
+			mem.LinkIdentity(ctx, linked.ID, issuer, "linked")
+			s := NewUserService(mem)
+
+			id := tt.identity
+			id.Issuer = issuer
+			user, err := s.resolveOIDCUser(ctx, &id)
+
+			if n := len(mem.Users()); n != tt.users {
+				t.Errorf("%d users, want %d", n, tt.users)
+			}
+			if tt.code != "" {
+				if e := apierror.From(err); e.Code != tt.code {
+					t.Fatalf("got %v, want code %s", err, tt.code)
+				}
+				if mem.Identity(issuer, id.Subject) != 0 {
+					t.Error("identity was linked")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if user.Email != tt.wantUser {
+				t.Errorf("resolved to %s, want %s", user.Email, tt.wantUser)
+			}
+			if got := mem.Identity(issuer, id.Subject); got != user.ID {
+				t.Errorf("identity linked to user %d, want %d", got, user.ID)
+			}
+
+			// the next login finds the identity without looking at the email
+			id.Email, id.EmailVerified = "", false
+			again, err := s.resolveOIDCUser(ctx, &id)
+			if err != nil || again.ID != user.ID {
+				t.Errorf("second login resolved to %+v, %v", again, err)
+			}
+		})
+	}
+}
+
+func TestProvisionOIDCUser(t *testing.T) {
+	mem := storetest.NewMemory()
+	s := NewUserService(mem)
+
+	tests := []struct {
+		identity  auth.OIDCIdentity
+		firstName string
+	}{
+		{auth.OIDCIdentity{Email: "ada@example.com", GivenName: "Ada", FamilyName: "Lovelace"}, "Ada"},
+		// the local part stands in for a missing given name
+		{auth.OIDCIdentity{Email: "grace@example.com"}, "grace"},
+	}
+
+	for _, tt := range tests {
+		user, err := s.provisionOIDCUser(context.Background(), &tt.identity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if user.Role != types.RoleUser || user.FirstName != tt.firstName || user.LastName != tt.identity.FamilyName {
+			t.Errorf("provisioned %+v", user)
+		}
+		if user.Password == "" {
+			t.Error("provisioned user has no password hash")
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package users
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/auth"
+	"github.com/AriJaya07/go-rest-api/packages/metrics"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+	"github.com/AriJaya07/go-rest-api/packages/utils"
+	"github.com/AriJaya07/go-rest-api/packages/validation"
+
+	"github.com/gorilla/mux"
+)
+
+const recoveryCodeCount = 10
+
+var errInvalidTwoFactorCode = apierror.Unauthorized("invalid_two_factor_code", "Invalid two-factor code")
+var errTwoFactorEnabled = apierror.Conflict("two_factor_enabled", "Two-factor authentication is already enabled")
+
+func (s *UserService) twoFactorEnabled(ctx context.Context, userID int64) (bool, error) {
+	t, err := s.store.GetTOTP(ctx, userID)
+	if apierror.KindOf(err) == apierror.KindNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return t.Confirmed, nil
+}
+
+// verifyTOTP checks a code against the user's confirmed secret and records
+// its time step so it cannot be reused.
+func (s *UserService) verifyTOTP(ctx context.Context, userID int64, code string) (bool, error) {
+	t, err := s.store.GetTOTP(ctx, userID)
+	if apierror.KindOf(err) == apierror.KindNotFound || (err == nil && !t.Confirmed) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	step, ok := auth.ValidateTOTP(t.Secret, code, time.Now(), t.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+
+	return s.store.UpdateTOTPStep(ctx, userID, step)
+}
+
+func (s *UserService) issueRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = auth.HashRecoveryCode(c)
+	}
+
+	if err := s.store.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (s *UserService) handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var input types.LoginTwoFactorRequest
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	errs, err := validation.Check(r.Context(), &input)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if input.Code == "" && input.RecoveryCode == "" {
+		errs.Add("code", "code or recoveryCode is required")
+	}
+	if err := errs.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	userID, err := auth.ParseLoginChallenge(input.Challenge)
+	if err != nil {
+		metrics.LoginsFailed.WithLabelValues("invalid_challenge").Inc()
+		apierror.Write(w, r, apierror.Unauthorized("invalid_challenge", err.Error()))
+		return
+	}
+
+	var ok bool
+	if input.Code != "" {
+		ok, err = s.verifyTOTP(r.Context(), userID, input.Code)
+	} else {
+		ok, err = s.store.UseRecoveryCode(r.Context(), userID, auth.HashRecoveryCode(input.RecoveryCode))
+	}
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if !ok {
+		metrics.LoginsFailed.WithLabelValues("invalid_second_factor").Inc()
+		apierror.Write(w, r, errInvalidTwoFactorCode)
+		return
+	}
+
+	user, err := s.store.GetUserByID(r.Context(), strconv.FormatInt(userID, 10))
+	if err != nil {
+		apierror.Write(w, r, errInvalidTwoFactorCode)
+		return
+	}
+
+	token, err := createAndSetAuthCookie(user.ID, user.Email, w)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.LoginResponse{Email: user.Email, Token: token})
+}
+
+func (s *UserService) handleTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.UserFromContext(r.Context())
+
+	enabled, err := s.twoFactorEnabled(r.Context(), user.ID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if enabled {
+		apierror.Write(w, r, errTwoFactorEnabled)
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := s.store.SaveTOTP(r.Context(), &types.TOTP{UserID: user.ID, Secret: secret}); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.TwoFactorEnrollResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(config.Envs.TOTPIssuer, user.Email, secret),
+	})
+}
+
+func (s *UserService) handleTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.UserFromContext(r.Context())
+
+	var input types.TwoFactorCodeRequest
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := validation.Struct(r.Context(), &input); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	t, err := s.store.GetTOTP(r.Context(), user.ID)
+	if apierror.KindOf(err) == apierror.KindNotFound {
+		apierror.Write(w, r, apierror.BadRequest("two_factor_not_started", "Two-factor enrollment has not been started"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if t.Confirmed {
+		apierror.Write(w, r, errTwoFactorEnabled)
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(t.Secret, input.Code, time.Now(), t.LastUsedStep)
+	if !ok {
+		apierror.Write(w, r, errInvalidTwoFactorCode)
+		return
+	}
+
+	if err := s.store.ConfirmTOTP(r.Context(), user.ID, step); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	codes, err := s.issueRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (s *UserService) handleTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.UserFromContext(r.Context())
+
+	var input types.TwoFactorCodeRequest
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := validation.Struct(r.Context(), &input); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	ok, err := s.verifyTOTP(r.Context(), user.ID, input.Code)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if !ok {
+		apierror.Write(w, r, errInvalidTwoFactorCode)
+		return
+	}
+
+	if err := s.store.DeleteTOTP(r.Context(), user.ID); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+func (s *UserService) handleRegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, _ := auth.UserFromContext(r.Context())
+
+	var input types.TwoFactorCodeRequest
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := validation.Struct(r.Context(), &input); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	ok, err := s.verifyTOTP(r.Context(), user.ID, input.Code)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if !ok {
+		apierror.Write(w, r, errInvalidTwoFactorCode)
+		return
+	}
+
+	codes, err := s.issueRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, types.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (s *UserService) handleAdminResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	idStr := mux.Vars(r)["id"]
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		apierror.Write(w, r, apierror.BadRequest("invalid_id", "Invalid user ID"))
+		return
+	}
+
+	if _, err := s.store.GetUserByID(r.Context(), idStr); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	if err := s.store.DeleteTOTP(r.Context(), id); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication reset"})
+}
@@ -0,0 +1,80 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/auth"
+	"github.com/AriJaya07/go-rest-api/packages/models/store/storetest"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+func TestLoginTwoFactorRecoveryCodes(t *testing.T) {
+	ctx := context.Background()
+	mem := storetest.NewMemory()
+	user, err := mem.CreateUser(ctx, &types.User{Email: "a@example.com", Role: types.RoleUser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := auth.GenerateTOTPSecret()
+	mem.SaveTOTP(ctx, &types.TOTP{UserID: user.ID, Secret: secret, Confirmed: true})
+
+	s := NewUserService(mem)
+	old, err := s.issueRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := s.issueRecoveryCodes(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	challenge, err := auth.CreateLoginChallenge([]byte(config.Envs.JWTSecret), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the logins run in order against one store
+	tests := []struct {
+		name   string
+		code   string
+		status int
+	}{
+		{name: "unused code", code: codes[0], status: http.StatusOK},
+		{name: "code used again", code: codes[0], status: http.StatusUnauthorized},
+		{name: "typed differently", code: " " + strings.ToUpper(codes[1]), status: http.StatusOK},
+		{name: "same code as typed before", code: codes[1], status: http.StatusUnauthorized},
+		{name: "replaced by regeneration", code: old[2], status: http.StatusUnauthorized},
+		{name: "unknown code", code: "aaaaa-aaaaa", status: http.StatusUnauthorized},
+		{name: "other codes still work", code: codes[2], status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		body, _ := json.Marshal(types.LoginTwoFactorRequest{Challenge: challenge, RecoveryCode: tt.code})
+		r := httptest.NewRequest(http.MethodPost, "/users/login/2fa", strings.NewReader(string(body)))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.handleLoginTwoFactor(w, r)
+
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		if tt.status == http.StatusOK {
+			var resp types.LoginResponse
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Token == "" {
+				t.Errorf("%s: no token in %+v, %v", tt.name, resp, err)
+			}
+			continue
+		}
+		var problem apierror.Error
+		if err := json.NewDecoder(w.Body).Decode(&problem); err != nil || problem.Code != "invalid_two_factor_code" {
+			t.Errorf("%s: got %+v, %v", tt.name, problem, err)
+		}
+	}
+}
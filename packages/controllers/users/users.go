@@ -1,35 +1,52 @@
 package users
 
 import (
-	"database/sql"
 	"encoding/json"
 	"errors"
-	"io"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
 	"github.com/AriJaya07/go-rest-api/packages/config"
 	"github.com/AriJaya07/go-rest-api/packages/controllers/auth"
+	"github.com/AriJaya07/go-rest-api/packages/metrics"
 	"github.com/AriJaya07/go-rest-api/packages/models/store"
 	"github.com/AriJaya07/go-rest-api/packages/models/types"
+	"github.com/AriJaya07/go-rest-api/packages/pagination"
 	"github.com/AriJaya07/go-rest-api/packages/utils"
+	"github.com/AriJaya07/go-rest-api/packages/validation"
 
 	"github.com/gorilla/mux"
-	"golang.org/x/crypto/bcrypt"
 )
 
-var errEmailRequired = errors.New("email is required")
-var errFirstNameRequired = errors.New("first name is required")
-var errLastNameRequired = errors.New("last name is required")
-var errPasswordRequired = errors.New("password is required")
+var errEmailNotVerified = apierror.Forbidden("email_not_verified", "Identity provider did not supply a verified email")
+
+// userReadOnly are the user members a PATCH may not change. Roles are only
+// assigned by provisioning, and passwords, which are not part of the
+// representation, have their own route.
+var userReadOnly = []string{"id", "role", "version", "createdAt", "updatedAt"}
 
 type UserService struct {
-	store store.Store
+	store         store.Store
+	authenticator auth.Authenticator
+	oidc          *auth.OIDCProvider
 }
 
 func NewUserService(s store.Store) *UserService {
-	return &UserService{store: s}
+	service := &UserService{store: s, authenticator: auth.NewAuthenticator(s)}
+
+	if config.Envs.OIDCIssuer != "" {
+		service.oidc = auth.NewOIDCProvider(auth.OIDCConfig{
+			Issuer:       config.Envs.OIDCIssuer,
+			ClientID:     config.Envs.OIDCClientID,
+			ClientSecret: config.Envs.OIDCClientSecret,
+			RedirectURL:  config.Envs.OIDCRedirectURL,
+			Scopes:       config.Envs.OIDCScopes,
+		}, nil)
+	}
+
+	return service
 }
 
 func (s *UserService) RegisterRoutes(r *mux.Router) {
@@ -39,167 +56,323 @@ func (s *UserService) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/users/edit-profile/{id}", s.handleUserUpdate).Methods("PUT")
 	r.HandleFunc("/users/delete/{id}", s.handleUserDelete).Methods("DELETE")
 	r.HandleFunc("/users/change-password/{id}", s.handleChangePassword).Methods("PUT")
+	// Two-factor authentication
+	r.HandleFunc("/users/login/2fa", s.handleLoginTwoFactor).Methods("POST")
+	r.HandleFunc("/users/2fa/enroll", auth.WithJWTAuth(s.handleTwoFactorEnroll, s.store)).Methods("POST")
+	r.HandleFunc("/users/2fa/confirm", auth.WithJWTAuth(s.handleTwoFactorConfirm, s.store)).Methods("POST")
+	r.HandleFunc("/users/2fa/disable", auth.WithJWTAuth(s.handleTwoFactorDisable, s.store)).Methods("POST")
+	r.HandleFunc("/users/2fa/recovery-codes", auth.WithJWTAuth(s.handleRegenerateRecoveryCodes, s.store)).Methods("POST")
+	r.HandleFunc("/users/admin/reset-2fa/{id}", auth.WithAdminAuth(s.handleAdminResetTwoFactor, s.store)).Methods("DELETE")
+	// OpenID Connect
+	if s.oidc != nil {
+		r.HandleFunc("/users/oidc/login", s.handleOIDCLogin).Methods("GET")
+		r.HandleFunc("/users/oidc/callback", s.handleOIDCCallback).Methods("GET")
+	}
+}
+
+// RegisterRoutesV2 mounts the resource-oriented user routes. Signing in,
+// two-factor authentication and OpenID Connect stay on the v1 routes.
+func (s *UserService) RegisterRoutesV2(r *mux.Router) {
+	r.HandleFunc("/users", auth.WithJWTAuth(s.handleGetAllUser, s.store)).Methods("GET")
+	r.HandleFunc("/users", s.handleUserRegisterV2).Methods("POST")
+	r.HandleFunc("/users/{id}", auth.WithJWTAuth(s.handleGetUser, s.store)).Methods("GET")
+	r.HandleFunc("/users/{id}", auth.WithOwnerAuth(s.handleUserUpdateV2, s.store)).Methods("PATCH")
+	r.HandleFunc("/users/{id}", auth.WithOwnerAuth(s.handleUserDeleteV2, s.store)).Methods("DELETE")
+	r.HandleFunc("/users/{id}/password", auth.WithOwnerAuth(s.handleChangePasswordV2, s.store)).Methods("PUT")
 }
 
 func (s *UserService) handleGetAllUser(w http.ResponseWriter, r *http.Request) {
-	users, err := s.store.GetAllUsers()
+	q := pagination.NewQuery(r)
+	filter := types.UserFilter{
+		Name:          q.String("name"),
+		Email:         q.String("email"),
+		Role:          q.OneOf("role", []string{types.RoleUser, types.RoleAdmin}),
+		CreatedAfter:  q.Time("createdAfter"),
+		CreatedBefore: q.Time("createdBefore"),
+	}
+	opts := q.ListOptions()
+	if err := q.Err(); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+
+	users, next, err := s.store.ListUsers(r.Context(), filter, opts)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Error getting all user"})
+		apierror.Write(w, r, err)
 		return
 	}
 
+	pagination.SetNext(w, r, next)
 	utils.WriteJSON(w, http.StatusOK, users)
 }
 
-func (s *UserService) handleUserRegister(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
+func (s *UserService) handleGetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := s.store.GetUserByID(r.Context(), mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "Error reading request body", http.StatusBadRequest)
+		apierror.Write(w, r, err)
 		return
 	}
 
-	defer r.Body.Close()
+	utils.WriteVersioned(w, r, user.Version, user)
+}
 
-	var payload *types.User
-	err = json.Unmarshal(body, &payload)
+func (s *UserService) handleUserRegister(w http.ResponseWriter, r *http.Request) {
+	_, response, err := s.registerUser(w, r)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: "Invalid request payload"})
+		apierror.Write(w, r, err)
 		return
 	}
 
-	if err := validateUserPayload(payload); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: err.Error()})
+	utils.WriteJSON(w, http.StatusCreated, response)
+}
+
+func (s *UserService) handleUserRegisterV2(w http.ResponseWriter, r *http.Request) {
+	u, response, err := s.registerUser(w, r)
+	if err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
+	utils.WriteCreated(w, r, u.ID, response)
+}
+
+// registerUser creates the account described by the body and signs the new
+// user in.
+func (s *UserService) registerUser(w http.ResponseWriter, r *http.Request) (*types.User, *types.LoginResponse, error) {
+	var input types.RegisterPayload
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		return nil, nil, err
+	}
+
+	// self-registered accounts are always plain users; only directory and
+	// identity provider provisioning assigns other roles
+	payload := &types.User{
+		Email:     input.Email,
+		FirstName: input.FirstName,
+		LastName:  input.LastName,
+		Password:  input.Password,
+		Role:      types.RoleUser,
+	}
+
+	errs, err := validation.Check(r.Context(), payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	if payload.Password != "" {
+		for _, problem := range auth.CheckPassword(payload.Password, payload) {
+			errs.Add("password", problem)
+		}
+	}
+	if err := errs.Err(); err != nil {
+		return nil, nil, err
+	}
+
 	hashedPW, err := auth.HashPassword(payload.Password)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Error creating user"})
-		return
+		return nil, nil, apierror.Internal(err)
 	}
 	payload.Password = hashedPW
 
-	u, err := s.store.CreateUser(payload)
+	u, err := s.store.CreateUser(r.Context(), payload)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Error creating user"})
-		return
+		return nil, nil, err
 	}
+	metrics.UsersRegistered.Inc()
 
 	token, err := createAndSetAuthCookie(u.ID, u.Email, w)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Error creating session"})
-		return
+		return nil, nil, apierror.Internal(err)
 	}
 
-	response := types.LoginResponse{
-		Email: u.Email,
-		Token: token,
-	}
-
-	utils.WriteJSON(w, http.StatusCreated, response)
+	return u, &types.LoginResponse{Email: u.Email, Token: token}, nil
 }
 
 func (s *UserService) handleUserLogin(w http.ResponseWriter, r *http.Request) {
 	// 1. Finf user in db by email
 	var input types.LoginRequest
 
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if err := validation.Struct(r.Context(), &input); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	// 2. compare password with hashed password
-	var user types.User
-	err := s.store.QueryRow("SELECT id, email, password FROM users WHERE email = ?", input.Email).Scan(&user.ID, &user.Email, &user.Password)
+	// 2. check the credentials against the configured providers
+	user, err := s.authenticator.Authenticate(r.Context(), input.Email, input.Password)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			metrics.LoginsFailed.WithLabelValues("invalid_credentials").Inc()
+			apierror.Write(w, r, apierror.Unauthorized("invalid_credentials", "Invalid email or password"))
 		} else {
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			apierror.Write(w, r, apierror.Internal(err))
 		}
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+	// 3. If two-factor authentication is enabled, stop here and hand out a
+	// challenge that must be completed at /users/login/2fa
+	enabled, err := s.twoFactorEnabled(r.Context(), user.ID)
+	if err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
+	if enabled {
+		challenge, err := auth.CreateLoginChallenge([]byte(config.Envs.JWTSecret), user.ID)
+		if err != nil {
+			apierror.Write(w, r, apierror.Internal(err))
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, types.LoginChallengeResponse{TwoFactorRequired: true, Challenge: challenge})
 		return
 	}
 
-	// 3. Create JWY and set it in a cookie
+	// 4. Create JWY and set it in a cookie
 	token, err := createAndSetAuthCookie(user.ID, user.Email, w)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Error user not found"})
+		apierror.Write(w, r, apierror.Internal(err))
 		return
 	}
 
-	// 4. Return JWT in response
+	// 5. Return JWT in response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"token": token, "email": user.Email})
 }
 
 func (s *UserService) handleChangePassword(w http.ResponseWriter, r *http.Request) {
-	idStr := mux.Vars(r)["id"]
+	if err := s.changePassword(w, r); err != nil {
+		apierror.Write(w, r, err)
+		return
+	}
 
-	// 1. Decode JSON input
-	var input types.ChangePassword
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Password update successfully"})
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: "Invalid request payload"})
+func (s *UserService) handleChangePasswordV2(w http.ResponseWriter, r *http.Request) {
+	if err := s.changePassword(w, r); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	defer r.Body.Close()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *UserService) changePassword(w http.ResponseWriter, r *http.Request) error {
+	idStr := mux.Vars(r)["id"]
+
+	// 1. Decode JSON input
+	var input types.ChangePassword
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		return err
+	}
 
 	// 2. Validate input
-	if input.CurrentPassword == "" || input.NewPassword == "" {
-		utils.WriteJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: "Invalid request payload"})
-		return
+	if err := validation.Struct(r.Context(), &input); err != nil {
+		return err
 	}
 
 	// Fetch user from store using userID (convert userID to string if required by your GetUserByID function)
-	user, err := s.store.GetUserByID(idStr)
+	user, err := s.store.GetUserByID(r.Context(), idStr)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusUnauthorized, types.ErrorResponse{Error: "Failed to fetch user"})
+		return err
+	}
+	if err := utils.CheckIfMatch(r, user.Version); err != nil {
+		return err
 	}
 
 	// verify current password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)); err != nil {
-		utils.WriteJSON(w, http.StatusUnauthorized, types.ErrorResponse{Error: "Invalid current password"})
-		return
+	if ok, _, err := auth.VerifyPassword(user.Password, input.CurrentPassword); err != nil || !ok {
+		return apierror.Unauthorized("invalid_current_password", "Invalid current password")
+	}
+
+	// 3. Check the new password against the policy
+	errs := validation.Errors{}
+	for _, problem := range auth.CheckPassword(input.NewPassword, user) {
+		errs.Add("new_password", problem)
+	}
+	if err := errs.Err(); err != nil {
+		return err
 	}
 
 	// 4. Update password
-	hashNewPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	hashNewPassword, err := auth.HashPassword(input.NewPassword)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Failed to generate hashed password"})
+		return apierror.Internal(err)
+	}
+
+	user.Password = hashNewPassword
+	return s.store.UpdatePassword(r.Context(), user)
+}
+
+func (s *UserService) handleUserUpdate(w http.ResponseWriter, r *http.Request) {
+	if _, err := s.updateUser(w, r); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	user.Password = string(hashNewPassword)
-	if err := s.store.UpdatePassword(user); err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Failed to update user"})
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "User updated successfully"})
+}
+
+// handleUserUpdateV2 applies a merge patch or JSON Patch to the user and
+// responds with the result.
+func (s *UserService) handleUserUpdateV2(w http.ResponseWriter, r *http.Request) {
+	user, err := s.patchUser(w, r)
+	if err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "Password update successfully"})
+	utils.WriteVersioned(w, r, user.Version, user)
 }
 
-func (s *UserService) handleUserUpdate(w http.ResponseWriter, r *http.Request) {
+func (s *UserService) patchUser(w http.ResponseWriter, r *http.Request) (*types.User, error) {
+	user, err := s.store.GetUserByID(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.CheckIfMatch(r, user.Version); err != nil {
+		return nil, err
+	}
+
+	hash := user.Password
+	if err := utils.DecodePatch(w, r, user, userReadOnly...); err != nil {
+		return nil, err
+	}
+	user.Password = hash
+	if err := validation.Struct(r.Context(), user); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.UpdateUser(r.Context(), user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *UserService) updateUser(w http.ResponseWriter, r *http.Request) (*types.User, error) {
 	idStr := mux.Vars(r)["id"]
 
 	// Decode JSON input
 	var input types.UserUpdateRequest
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, types.ErrorResponse{Error: "Invalid request payload"})
-		return
+	if err := utils.DecodeJSON(w, r, &input); err != nil {
+		return nil, err
+	}
+
+	if err := validation.Struct(r.Context(), &input); err != nil {
+		return nil, err
 	}
-	defer r.Body.Close()
 
 	// Fetch user from store
-	user, err := s.store.GetUserByID(idStr)
+	user, err := s.store.GetUserByID(r.Context(), idStr)
 	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Failed to fetch user"})
-		return
+		return nil, err
+	}
+	if err := utils.CheckIfMatch(r, user.Version); err != nil {
+		return nil, err
 	}
 
 	// Update user fields
@@ -214,39 +387,16 @@ func (s *UserService) handleUserUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Update user in store
-	if err := s.store.UpdateUser(user); err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Failed to update user"})
-		return
+	if err := s.store.UpdateUser(r.Context(), user); err != nil {
+		return nil, err
 	}
 
-	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "User updated successfully"})
+	return user, nil
 }
 
 func (s *UserService) handleUserDelete(w http.ResponseWriter, r *http.Request) {
-	idStr := mux.Vars(r)["id"]
-	if idStr == "" {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Missing user ID"})
-		return
-	}
-
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Invalid user ID"})
-		return
-	}
-
-	if _, err := s.store.GetUserByID(idStr); err != nil {
-		if err == sql.ErrNoRows {
-			utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "User not found"})
-			return
-		} else {
-			utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Failed to check user existence"})
-		}
-	}
-
-	// Delete the user
-	if err := s.store.DeleteUser(id); err != nil {
-		utils.WriteJSON(w, http.StatusInternalServerError, types.ErrorResponse{Error: "Failed to delete user"})
+	if err := s.deleteUser(r); err != nil {
+		apierror.Write(w, r, err)
 		return
 	}
 
@@ -254,24 +404,30 @@ func (s *UserService) handleUserDelete(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
 }
 
-func validateUserPayload(user *types.User) error {
-	if user.Email == "" {
-		return errEmailRequired
+func (s *UserService) handleUserDeleteV2(w http.ResponseWriter, r *http.Request) {
+	if err := s.deleteUser(r); err != nil {
+		apierror.Write(w, r, err)
+		return
 	}
 
-	if user.FirstName == "" {
-		return errFirstNameRequired
-	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	if user.LastName == "" {
-		return errLastNameRequired
+func (s *UserService) deleteUser(r *http.Request) error {
+	idStr := mux.Vars(r)["id"]
+	if _, err := strconv.ParseInt(idStr, 10, 64); err != nil {
+		return apierror.BadRequest("invalid_id", "Invalid user ID")
 	}
 
-	if user.Password == "" {
-		return errPasswordRequired
+	user, err := s.store.GetUserByID(r.Context(), idStr)
+	if err != nil {
+		return err
+	}
+	if err := utils.CheckIfMatch(r, user.Version); err != nil {
+		return err
 	}
 
-	return nil
+	return s.store.DeleteUser(r.Context(), user.ID, user.Version)
 }
 
 func createAndSetAuthCookie(id int64, email string, w http.ResponseWriter) (string, error) {
@@ -281,12 +437,7 @@ func createAndSetAuthCookie(id int64, email string, w http.ResponseWriter) (stri
 		return "", err
 	}
 
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    token,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-	})
+	auth.SetSessionCookies(w, token, time.Now().Add(24*time.Hour))
 
 	return token, nil
 }
@@ -0,0 +1,79 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/auth"
+	"github.com/AriJaya07/go-rest-api/packages/models/store/storetest"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+// downAuthenticator stands in for a provider that cannot be reached.
+type downAuthenticator struct{}
+
+func (downAuthenticator) Name() string {
+	return "down"
+}
+
+func (downAuthenticator) Authenticate(ctx context.Context, username, password string) (*types.User, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestUserLoginProviderOutage(t *testing.T) {
+	mem := storetest.NewMemory()
+	hash, err := auth.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem.CreateUser(context.Background(), &types.User{Email: "a@example.com", Password: hash, Role: types.RoleUser})
+
+	local := auth.NewLocalAuthenticator(mem)
+	tests := []struct {
+		name     string
+		chain    auth.Chain
+		email    string
+		password string
+		status   int
+		code     string
+	}{
+		{name: "signs in", chain: auth.Chain{downAuthenticator{}, local},
+			email: "a@example.com", password: "correct horse", status: http.StatusOK},
+		{name: "wrong password", chain: auth.Chain{downAuthenticator{}, local},
+			email: "a@example.com", password: "wrong", status: http.StatusUnauthorized, code: "invalid_credentials"},
+		{name: "unknown user", chain: auth.Chain{local, downAuthenticator{}},
+			email: "nobody@example.com", password: "wrong", status: http.StatusUnauthorized, code: "invalid_credentials"},
+		{name: "no provider could answer", chain: auth.Chain{downAuthenticator{}},
+			email: "a@example.com", password: "correct horse", status: http.StatusInternalServerError, code: apierror.CodeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewUserService(mem)
+			s.authenticator = tt.chain
+
+			body, _ := json.Marshal(types.LoginRequest{Email: tt.email, Password: tt.password})
+			r := httptest.NewRequest(http.MethodPost, "/users/login", strings.NewReader(string(body)))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.handleUserLogin(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.code == "" {
+				return
+			}
+			var problem apierror.Problem
+			if err := json.NewDecoder(w.Body).Decode(&problem); err != nil || problem.Code != tt.code {
+				t.Errorf("got %+v, %v, want code %s", problem, err, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/AriJaya07/go-rest-api/packages/config"
+)
+
+type contextKey string
+
+const loggerKey contextKey = "logger"
+
+// New builds a logger writing to w. format is "json" or "text"; level is
+// one of debug, info, warn or error.
+func New(w io.Writer, format, level string) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: ParseLevel(level)}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "text") {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.New(handler)
+}
+
+// Init installs the configured logger as the process default, so both slog
+// and the standard log package go through it.
+func Init() {
+	slog.SetDefault(New(os.Stderr, config.Envs.LogFormat, config.Envs.LogLevel))
+}
+
+func ParseLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+
+	return l
+}
+
+// WithAttrs returns a context whose logger carries the extra attributes,
+// e.g. the request ID or the authenticated user ID.
+func WithAttrs(ctx context.Context, args ...any) context.Context {
+	return context.WithValue(ctx, loggerKey, FromContext(ctx).With(args...))
+}
+
+// FromContext returns the request-scoped logger, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+
+	return slog.Default()
+}
@@ -0,0 +1,78 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestWithAttrs(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(New(&buf, "json", "info"))
+	defer slog.SetDefault(prev)
+
+	ctx := WithAttrs(context.Background(), slog.String("request_id", "abc"))
+	FromContext(ctx).Info("handled")
+	// later attributes add to the request's, as auth does with the user
+	FromContext(WithAttrs(ctx, slog.Int64("user_id", 7))).Info("authenticated")
+	FromContext(context.Background()).Info("background")
+
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		lines = append(lines, entry)
+	}
+	if len(lines) != 3 {
+		t.Fatalf("got %d log lines, want 3", len(lines))
+	}
+
+	if lines[0]["request_id"] != "abc" {
+		t.Errorf("handled: request_id = %v", lines[0]["request_id"])
+	}
+	if lines[1]["request_id"] != "abc" || lines[1]["user_id"] != float64(7) {
+		t.Errorf("authenticated: got %v", lines[1])
+	}
+	if _, ok := lines[2]["request_id"]; ok {
+		t.Errorf("background line has a request ID: %v", lines[2])
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		format string
+		level  string
+		// want is in the output of Info("hello", "k", "v"), empty when
+		// the level filters it out
+		want string
+	}{
+		{"json", "info", `"msg":"hello","k":"v"`},
+		{"JSON", "debug", `"msg":"hello","k":"v"`},
+		{"text", "info", `msg=hello k=v`},
+		{"TEXT", "info", `msg=hello k=v`},
+		{"json", "warn", ""},
+		{"json", "ERROR", ""},
+		{"json", "nonsense", `"msg":"hello"`}, // falls back to info
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		New(&buf, tt.format, tt.level).Info("hello", "k", "v")
+
+		if tt.want == "" {
+			if buf.Len() != 0 {
+				t.Errorf("%s/%s: logged %q below the level", tt.format, tt.level, buf.String())
+			}
+			continue
+		}
+		if !strings.Contains(buf.String(), tt.want) {
+			t.Errorf("%s/%s: logged %q, want it to contain %q", tt.format, tt.level, buf.String(), tt.want)
+		}
+	}
+}
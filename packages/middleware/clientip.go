@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPResolver finds the client address of a request. X-Forwarded-For is
+// only honoured when the request comes from a trusted proxy, and then the
+// right-most address that is not itself a trusted proxy is used, so clients
+// cannot spoof their address by sending the header themselves.
+type IPResolver struct {
+	trusted []*net.IPNet
+}
+
+// NewIPResolver accepts CIDRs or bare IPs; invalid entries are ignored.
+func NewIPResolver(trustedProxies []string) *IPResolver {
+	resolver := &IPResolver{}
+
+	for _, p := range trustedProxies {
+		if !strings.Contains(p, "/") {
+			if strings.Contains(p, ":") {
+				p += "/128"
+			} else {
+				p += "/32"
+			}
+		}
+		if _, n, err := net.ParseCIDR(p); err == nil {
+			resolver.trusted = append(resolver.trusted, n)
+		}
+	}
+
+	return resolver
+}
+
+func (res *IPResolver) isTrusted(ip net.IP) bool {
+	for _, n := range res.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (res *IPResolver) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !res.isTrusted(ip) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		if !res.isTrusted(hop) {
+			return hop.String()
+		}
+	}
+
+	return host
+}
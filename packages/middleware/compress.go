@@ -0,0 +1,299 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// encoders in order of preference when the client rates them equally.
+var encoders = []struct {
+	name string
+	pool *sync.Pool
+}{
+	{"br", &sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, brotli.DefaultCompression) }}},
+	{"zstd", &sync.Pool{New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return w
+	}}},
+	{"gzip", &sync.Pool{New: func() any { return gzip.NewWriter(nil) }}},
+}
+
+type encoder interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+// incompressible content types are already compressed; compressing them
+// again costs CPU for no gain.
+var incompressible = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zip":              true,
+	"application/zstd":             true,
+	"application/x-brotli":         true,
+	"application/octet-stream":     true,
+	"application/pdf":              true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+}
+
+func compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// unknown types are most likely our JSON
+		return true
+	}
+	if strings.HasPrefix(mt, "image/") && mt != "image/svg+xml" {
+		return false
+	}
+	if strings.HasPrefix(mt, "video/") || strings.HasPrefix(mt, "audio/") || strings.HasPrefix(mt, "font/woff") {
+		return false
+	}
+
+	return !incompressible[mt]
+}
+
+// negotiateEncoding picks the best encoding from Accept-Encoding, or "" for
+// none.
+func negotiateEncoding(header string) (string, *sync.Pool) {
+	if header == "" {
+		return "", nil
+	}
+
+	q := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		weight := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				weight = f
+			}
+		}
+		q[strings.ToLower(strings.TrimSpace(name))] = weight
+	}
+
+	best, bestQ := -1, 0.0
+	for i, e := range encoders {
+		w, ok := q[e.name]
+		if !ok {
+			w, ok = q["*"]
+		}
+		if ok && w > bestQ {
+			best, bestQ = i, w
+		}
+	}
+	if best < 0 {
+		return "", nil
+	}
+
+	return encoders[best].name, encoders[best].pool
+}
+
+// codingETag marks a strong entity tag with the coding its representation
+// was compressed with, since the bytes differ from the identity ones. Weak
+// tags are returned unchanged.
+func codingETag(etag, coding string) string {
+	if len(etag) < 2 || etag[0] != '"' || etag[len(etag)-1] != '"' {
+		return etag
+	}
+	return etag[:len(etag)-1] + "-" + coding + `"`
+}
+
+// stripCoding undoes codingETag.
+func stripCoding(tag string) string {
+	for _, e := range encoders {
+		if base, ok := strings.CutSuffix(tag, "-"+e.name+`"`); ok && strings.HasPrefix(base, `"`) {
+			return base + `"`
+		}
+	}
+	return tag
+}
+
+// stripCodings removes the codings from the tags in the request's
+// If-Match and If-None-Match headers, so handlers compare against the tags
+// they set. It returns the If-None-Match tags as sent, keyed by their
+// stripped form, for a 304 to echo.
+func stripCodings(r *http.Request) map[string]string {
+	sent := map[string]string{}
+	for _, name := range []string{"If-Match", "If-None-Match"} {
+		header := r.Header.Get(name)
+		if header == "" {
+			continue
+		}
+
+		tags := strings.Split(header, ",")
+		changed := false
+		for i, tag := range tags {
+			tag = strings.TrimSpace(tag)
+			tags[i] = stripCoding(tag)
+			if tags[i] != tag {
+				changed = true
+				if name == "If-None-Match" {
+					sent[tags[i]] = tag
+				}
+			}
+		}
+		if changed {
+			r.Header.Set(name, strings.Join(tags, ", "))
+		}
+	}
+	return sent
+}
+
+// Compress encodes responses of at least minSize bytes with the best
+// encoding the client accepts. Smaller bodies are sent as is, since
+// compression overhead would outweigh the savings.
+//
+// Strong ETags of compressed responses get the coding appended, as each
+// coding is a different representation. The coding is stripped from the
+// tags clients send back, so If-Match and If-None-Match keep working
+// against the handler's own tags.
+func Compress(minSize int) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			sent := stripCodings(r)
+
+			name, pool := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if pool == nil || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{ResponseWriter: w, name: name, pool: pool, minSize: minSize, status: http.StatusOK, sent: sent}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// compressWriter buffers the start of a response until it knows whether the
+// body is large enough to be worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	name    string
+	pool    *sync.Pool
+	minSize int
+	sent    map[string]string // If-None-Match tags as sent, by stripped tag
+
+	status      int
+	wroteHeader bool // WriteHeader was called by the handler
+	decided     bool // headers have been sent downstream
+	buf         []byte
+	enc         encoder
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = status
+
+	// informational and bodiless responses go straight through
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified {
+		// a 304 names the representation the client already holds
+		if status == http.StatusNotModified {
+			if tag, ok := cw.sent[cw.Header().Get("ETag")]; ok {
+				cw.Header().Set("ETag", tag)
+			}
+		}
+		cw.decided = true
+		cw.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// decide sends the headers, starting compression if large is set and the
+// response is eligible, and flushes the buffered body.
+func (cw *compressWriter) decide(large bool) error {
+	cw.decided = true
+	h := cw.Header()
+
+	if large && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.name)
+		if etag := h.Get("ETag"); etag != "" {
+			h.Set("ETag", codingETag(etag, cw.name))
+		}
+
+		cw.enc = cw.pool.Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// Flush starts compressing early, so streamed responses are not held back
+// by the size threshold.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		if !cw.wroteHeader {
+			cw.WriteHeader(http.StatusOK)
+		}
+		cw.decide(true)
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided && (cw.wroteHeader || len(cw.buf) > 0) {
+		cw.decide(false)
+	}
+
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.enc.Reset(nil)
+		cw.pool.Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,245 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"gzip, deflate, br", "br"},
+		{"gzip, zstd", "zstd"},
+		{"br;q=0.5, gzip;q=0.8", "gzip"},
+		{"BR", "br"},
+		{"br;q=0, gzip", "gzip"},
+		{"gzip;q=0", ""},
+		{"*", "br"},
+		{"*;q=0.1, gzip;q=0.5", "gzip"},
+		{"br;q=0, *", "zstd"},
+		{"gzip;q=abc", "gzip"},
+		{"deflate", ""},
+	}
+
+	for _, tt := range tests {
+		if got, _ := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var r io.Reader
+	switch encoding {
+	case "":
+		return string(body)
+	case "gzip":
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		t.Fatalf("unexpected encoding %q", encoding)
+	}
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCompress(t *testing.T) {
+	large := `{"items":"` + strings.Repeat("abc", 400) + `"}`
+	small := `{"ok":true}`
+
+	tests := []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		contentType    string
+		encoded        string // Content-Encoding set by the handler
+		status         int
+		body           string
+		want           string // Content-Encoding of the response
+	}{
+		{name: "gzip", acceptEncoding: "gzip", body: large, want: "gzip"},
+		{name: "brotli preferred", acceptEncoding: "gzip, br", body: large, want: "br"},
+		{name: "zstd", acceptEncoding: "zstd", body: large, want: "zstd"},
+		{name: "not accepted", body: large},
+		{name: "unsupported encoding", acceptEncoding: "deflate", body: large},
+		{name: "below threshold", acceptEncoding: "gzip", body: small},
+		{name: "exactly the threshold", acceptEncoding: "gzip", body: strings.Repeat("a", 1024), want: "gzip"},
+		{name: "HEAD", method: http.MethodHead, acceptEncoding: "gzip"},
+		{name: "image", acceptEncoding: "gzip", contentType: "image/png", body: large},
+		{name: "svg is text", acceptEncoding: "gzip", contentType: "image/svg+xml", body: large, want: "gzip"},
+		{name: "zip", acceptEncoding: "gzip", contentType: "application/zip", body: large},
+		{name: "octet stream with parameters", acceptEncoding: "gzip", contentType: "application/octet-stream; charset=binary", body: large},
+		{name: "already encoded", acceptEncoding: "gzip", encoded: "br", body: large, want: "br"},
+		{name: "error status", acceptEncoding: "gzip", status: http.StatusNotFound, body: large, want: "gzip"},
+		{name: "no content", acceptEncoding: "gzip", status: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			contentType := tt.contentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			handler := Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", contentType)
+				w.Header().Set("Content-Length", "123")
+				if tt.encoded != "" {
+					w.Header().Set("Content-Encoding", tt.encoded)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+				}
+				// in pieces, so the threshold is crossed part way through
+				for len(tt.body) > 0 {
+					n := min(len(tt.body), 100)
+					w.Write([]byte(tt.body[:n]))
+					tt.body = tt.body[n:]
+				}
+			}))
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			r := httptest.NewRequest(method, "/", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			want := tt.body
+			handler.ServeHTTP(w, r)
+
+			h := w.Header()
+			if got := h.Get("Content-Encoding"); got != tt.want {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.want)
+			}
+			if got := h.Values("Vary"); len(got) != 1 || got[0] != "Accept-Encoding" {
+				t.Errorf("Vary = %q", got)
+			}
+			if tt.want != "" && tt.encoded == "" {
+				if h.Get("Content-Length") != "" {
+					t.Error("Content-Length of the uncompressed body was kept")
+				}
+				if got := decompress(t, tt.want, w.Body.Bytes()); got != want {
+					t.Errorf("body does not round-trip: got %d bytes, want %d", len(got), len(want))
+				}
+			} else if tt.encoded == "" && w.Body.String() != want {
+				t.Errorf("body changed: got %d bytes, want %d", w.Body.Len(), len(want))
+			}
+			if tt.status != 0 && w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	handler := Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+		http.NewResponseController(w).Flush()
+		w.Write([]byte("data: 2\n\n"))
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	// flushing starts compression below the threshold, so streamed
+	// responses are not held back
+	if !w.Flushed || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("flushed = %v, Content-Encoding = %q", w.Flushed, w.Header().Get("Content-Encoding"))
+	}
+	if got := decompress(t, "gzip", w.Body.Bytes()); got != "data: 1\n\ndata: 2\n\n" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestCompressETag(t *testing.T) {
+	large := strings.Repeat("abc", 400)
+	// the handler knows only its own tag, as utils.WriteVersioned does
+	handler := Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"3"`)
+		if m := r.Header.Get("If-Match"); m != "" && m != `"3"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"3"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(large))
+	}))
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		header         string
+		tag            string
+		status         int
+		etag           string
+	}{
+		{name: "gzip", acceptEncoding: "gzip", status: http.StatusOK, etag: `"3-gzip"`},
+		{name: "brotli", acceptEncoding: "br", status: http.StatusOK, etag: `"3-br"`},
+		{name: "identity", status: http.StatusOK, etag: `"3"`},
+		{name: "not modified", acceptEncoding: "gzip", header: "If-None-Match", tag: `"3-gzip"`, status: http.StatusNotModified, etag: `"3-gzip"`},
+		{name: "not modified identity", acceptEncoding: "gzip", header: "If-None-Match", tag: `"3"`, status: http.StatusNotModified, etag: `"3"`},
+		{name: "modified", acceptEncoding: "gzip", header: "If-None-Match", tag: `"2-gzip"`, status: http.StatusOK, etag: `"3-gzip"`},
+		{name: "if-match compressed tag", acceptEncoding: "br", header: "If-Match", tag: `"3-gzip"`, status: http.StatusOK, etag: `"3-br"`},
+		{name: "if-match identity tag", header: "If-Match", tag: `"3"`, status: http.StatusOK, etag: `"3"`},
+		{name: "if-match stale", acceptEncoding: "gzip", header: "If-Match", tag: `"2-gzip"`, status: http.StatusPreconditionFailed, etag: `"3"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptEncoding != "" {
+				r.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.tag)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("ETag"); got != tt.etag {
+				t.Errorf("ETag = %s, want %s", got, tt.etag)
+			}
+		})
+	}
+}
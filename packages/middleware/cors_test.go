@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name        string
+		origins     []string
+		origin      string
+		preflight   bool
+		status      int
+		allow       string
+		credentials string
+	}{
+		{name: "listed origin", origins: []string{"https://app.example.com"}, origin: "https://App.example.com",
+			status: http.StatusOK, allow: "https://App.example.com", credentials: "true"},
+		{name: "unlisted origin", origins: []string{"https://app.example.com"}, origin: "https://evil.example.com",
+			status: http.StatusOK},
+		{name: "no origin", origins: []string{"*"}, status: http.StatusOK},
+		{name: "wildcard is literal and without credentials", origins: []string{"*"}, origin: "https://evil.example.com",
+			status: http.StatusOK, allow: "*"},
+		{name: "listed origin beside wildcard keeps credentials", origins: []string{"*", "https://app.example.com"}, origin: "https://app.example.com",
+			status: http.StatusOK, allow: "https://app.example.com", credentials: "true"},
+		{name: "wildcard preflight", origins: []string{"*"}, origin: "https://evil.example.com", preflight: true,
+			status: http.StatusNoContent, allow: "*"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := CORS(CORSConfig{
+				AllowedOrigins:   tt.origins,
+				AllowedMethods:   []string{"GET", "POST"},
+				AllowCredentials: true,
+			})(next)
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.preflight {
+				r.Method = http.MethodOptions
+				r.Header.Set("Access-Control-Request-Method", "POST")
+			}
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allow)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.credentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.credentials)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/logging"
+)
+
+// AccessLog logs one line per request with its outcome and latency.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, info := withInfo(r)
+		rec := newResponseRecorder(w)
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		attrs := []any{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+		}
+		if info.userID != 0 {
+			attrs = append(attrs, slog.Int64("user_id", info.userID))
+		}
+
+		logging.FromContext(r.Context()).Info("request", attrs...)
+	})
+}
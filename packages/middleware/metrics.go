@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/metrics"
+	"github.com/gorilla/mux"
+)
+
+// RouteTemplate is a mux middleware that records the matched route template
+// (e.g. /api/v1/projects/detail/{id}) so outer middleware can label by route
+// instead of by raw path.
+func RouteTemplate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, info := withInfo(r)
+		if route := mux.CurrentRoute(r); route != nil {
+			if tpl, err := route.GetPathTemplate(); err == nil {
+				info.route = tpl
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RouteFromContext returns the template recorded by RouteTemplate, or "".
+func RouteFromContext(r *http.Request) string {
+	if info := infoFromContext(r.Context()); info != nil {
+		return info.route
+	}
+
+	return ""
+}
+
+// Metrics records request counts and latencies.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r, info := withInfo(r)
+		rec := newResponseRecorder(w)
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		route := info.route
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(rec.status)
+
+		metrics.HTTPRequests.WithLabelValues(r.Method, route, status).Inc()
+		metrics.HTTPDuration.WithLabelValues(r.Method, route, status).Observe(time.Since(start).Seconds())
+	})
+}
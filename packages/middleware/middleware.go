@@ -0,0 +1,106 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// Middleware wraps a handler with cross-cutting behaviour.
+type Middleware func(http.Handler) http.Handler
+
+// Chain applies middlewares so that the first one listed is the outermost.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+
+	return h
+}
+
+type contextKey string
+
+const requestInfoKey contextKey = "requestInfo"
+
+// requestInfo is shared by every middleware and handler serving a request.
+// It is a pointer so values set deep in the handler chain (such as the user
+// resolved by auth) are visible to outer middleware like the access log.
+type requestInfo struct {
+	requestID string
+	userID    int64
+	route     string
+}
+
+func infoFromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey).(*requestInfo)
+	return info
+}
+
+func withInfo(r *http.Request) (*http.Request, *requestInfo) {
+	if info := infoFromContext(r.Context()); info != nil {
+		return r, info
+	}
+
+	info := &requestInfo{}
+	return r.WithContext(context.WithValue(r.Context(), requestInfoKey, info)), info
+}
+
+// RequestIDFromContext returns the ID assigned by RequestID, or "".
+func RequestIDFromContext(ctx context.Context) string {
+	if info := infoFromContext(ctx); info != nil {
+		return info.requestID
+	}
+
+	return ""
+}
+
+// SetUserID records the authenticated user for the access log.
+func SetUserID(ctx context.Context, id int64) {
+	if info := infoFromContext(ctx); info != nil {
+		info.userID = id
+	}
+}
+
+// UserIDFromContext returns the user recorded by SetUserID, or 0.
+func UserIDFromContext(ctx context.Context) int64 {
+	if info := infoFromContext(ctx); info != nil {
+		return info.userID
+	}
+
+	return 0
+}
+
+// responseRecorder captures the status code and body size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	if rec, ok := w.(*responseRecorder); ok {
+		return rec
+	}
+
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,322 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/logging"
+	"github.com/AriJaya07/go-rest-api/packages/validation"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+func init() {
+	// error responses and merge patches are JSON under their own media types
+	openapi3filter.RegisterBodyDecoder(apierror.ContentType, openapi3filter.JSONBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", openapi3filter.JSONBodyDecoder)
+}
+
+type OpenAPIConfig struct {
+	// Spec is the OpenAPI 3 document requests are checked against.
+	Spec []byte
+	// MaxBodyBytes limits the request bodies read for validation. Larger
+	// bodies are rejected with 413. Zero means no limit.
+	MaxBodyBytes int64
+	// ValidateResponses buffers every response and checks it against the
+	// spec as well. It is meant for tests and staging, not production.
+	ValidateResponses bool
+	// OnResponseError is called with each invalid response. The response is
+	// still sent unchanged. Defaults to logging the error.
+	OnResponseError func(r *http.Request, err error)
+}
+
+// OpenAPIValidation rejects requests whose path parameters, query string or
+// body do not match the operation in the spec, before the handler runs.
+// Requests for paths the spec does not describe are passed through so the
+// router can answer them as usual.
+//
+// Requests to secured operations that carry none of the credentials the
+// spec names are not checked but passed on for the handler to answer 401,
+// so anonymous callers learn nothing about the schema. Whether credentials
+// are valid is left to the handlers.
+func OpenAPIValidation(cfg OpenAPIConfig) (Middleware, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(cfg.Spec)
+	if err != nil {
+		return nil, fmt.Errorf("loading OpenAPI spec: %w", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	onResponseError := cfg.OnResponseError
+	if onResponseError == nil {
+		onResponseError = func(r *http.Request, err error) {
+			logging.FromContext(r.Context()).Error("response does not match the OpenAPI spec", slog.Any("error", err))
+		}
+	}
+
+	options := &openapi3filter.Options{
+		MultiError:         true,
+		AuthenticationFunc: credentialsPresent,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, params, err := router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if cfg.MaxBodyBytes > 0 && r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBodyBytes)
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: params,
+				Route:      route,
+				Options:    options,
+			}
+			var securityErr *openapi3filter.SecurityRequirementsError
+			if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil && !errors.As(err, &securityErr) {
+				writeValidationError(w, r, err)
+				return
+			}
+
+			if !cfg.ValidateResponses {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			if err := validateResponse(r.Context(), input, rec); err != nil {
+				onResponseError(r, err)
+			}
+			rec.flush(w)
+		})
+	}, nil
+}
+
+// credentialsPresent accepts a security scheme when the request carries the
+// header, cookie or query parameter it names.
+func credentialsPresent(ctx context.Context, input *openapi3filter.AuthenticationInput) error {
+	r := input.RequestValidationInput.Request
+	scheme := input.SecurityScheme
+
+	var value string
+	switch scheme.In {
+	case "header":
+		value = r.Header.Get(scheme.Name)
+	case "query":
+		value = r.URL.Query().Get(scheme.Name)
+	case "cookie":
+		if c, err := r.Cookie(scheme.Name); err == nil {
+			value = c.Value
+		}
+	}
+	if value == "" {
+		return fmt.Errorf("no credentials for %s", input.SecuritySchemeName)
+	}
+
+	return nil
+}
+
+func validateResponse(ctx context.Context, input *openapi3filter.RequestValidationInput, rec *bufferedResponse) error {
+	// bodies such as the docs page cannot be decoded, so only their status
+	// and content type are checked
+	mediaType, _, _ := mime.ParseMediaType(rec.header.Get("Content-Type"))
+	out := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 rec.status,
+		Header:                 rec.header,
+		Options: &openapi3filter.Options{
+			MultiError:            true,
+			IncludeResponseStatus: true,
+			ExcludeResponseBody:   openapi3filter.RegisteredBodyDecoder(mediaType) == nil,
+		},
+	}
+	out.SetBodyBytes(rec.body.Bytes())
+
+	if err := openapi3filter.ValidateResponse(ctx, out); err != nil {
+		return fmt.Errorf("%s %s -> %d: %w", input.Request.Method, input.Route.Path, rec.status, err)
+	}
+
+	return nil
+}
+
+// writeValidationError answers with every problem found, keyed by the
+// offending parameter name or the JSON path of the body field, in the same
+// 422 shape the handlers use. Bodies that cannot be read as JSON at all are
+// rejected with 400, 413 or 415 instead.
+func writeValidationError(w http.ResponseWriter, r *http.Request, err error) {
+	errs := validation.Errors{}
+
+	for _, reqErr := range requestErrors(err) {
+		var (
+			parseErr *openapi3filter.ParseError
+			maxErr   *http.MaxBytesError
+		)
+		switch {
+		case reqErr.RequestBody != nil && errors.As(reqErr.Err, &maxErr):
+			apierror.Write(w, r, apierror.New(apierror.KindPayloadTooLarge, apierror.CodePayloadTooLarge, fmt.Sprintf("Request body must not be larger than %d bytes", maxErr.Limit)))
+			return
+		case reqErr.Parameter != nil:
+			for _, msg := range schemaMessages(reqErr.Err, reqErr.Reason) {
+				errs.Add(reqErr.Parameter.Name, msg)
+			}
+		case reqErr.RequestBody != nil && strings.HasPrefix(reqErr.Reason, "header Content-Type"):
+			apierror.Write(w, r, apierror.New(apierror.KindUnsupportedMediaType, apierror.CodeUnsupportedMediaType, "Content-Type must be "+mediaTypes(reqErr.RequestBody.Content)))
+			return
+		case reqErr.RequestBody != nil && errors.As(reqErr.Err, &parseErr):
+			apierror.Write(w, r, apierror.BadRequest("invalid_json", "Request body is not valid JSON"))
+			return
+		case reqErr.RequestBody != nil:
+			addBodyErrors(errs, reqErr)
+		default:
+			errs.Add("request", reqErr.Error())
+		}
+	}
+
+	apierror.Write(w, r, errs.Err())
+}
+
+// mediaTypes lists the media types an operation accepts, for messages.
+func mediaTypes(content openapi3.Content) string {
+	types := make([]string, 0, len(content))
+	for mediaType := range content {
+		types = append(types, mediaType)
+	}
+	slices.Sort(types)
+
+	if len(types) < 2 {
+		return strings.Join(types, "")
+	}
+	return strings.Join(types[:len(types)-1], ", ") + " or " + types[len(types)-1]
+}
+
+// requestErrors flattens the top level of a validation error. Type
+// assertions are used instead of errors.As, which would look through a
+// RequestError into the schema errors it wraps.
+func requestErrors(err error) []*openapi3filter.RequestError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var out []*openapi3filter.RequestError
+		for _, inner := range e {
+			out = append(out, requestErrors(inner)...)
+		}
+		return out
+	case *openapi3filter.RequestError:
+		return []*openapi3filter.RequestError{e}
+	}
+
+	return []*openapi3filter.RequestError{{Reason: err.Error()}}
+}
+
+func addBodyErrors(errs validation.Errors, reqErr *openapi3filter.RequestError) {
+	if errors.Is(reqErr.Err, openapi3filter.ErrInvalidRequired) {
+		errs.Add("body", "is required")
+		return
+	}
+
+	for _, se := range schemaErrors(reqErr.Err) {
+		field := strings.Join(se.JSONPointer(), ".")
+		if field == "" {
+			field = "body"
+		}
+		errs.Add(field, schemaErrorMessage(se))
+	}
+}
+
+func schemaMessages(err error, reason string) []string {
+	var msgs []string
+	for _, se := range schemaErrors(err) {
+		msgs = append(msgs, schemaErrorMessage(se))
+	}
+	if len(msgs) == 0 {
+		if reason == "" && err != nil {
+			reason = err.Error()
+		}
+		msgs = append(msgs, reason)
+	}
+
+	return msgs
+}
+
+func schemaErrors(err error) []*openapi3.SchemaError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var out []*openapi3.SchemaError
+		for _, inner := range e {
+			out = append(out, schemaErrors(inner)...)
+		}
+		return out
+	case *openapi3.SchemaError:
+		return []*openapi3.SchemaError{e}
+	}
+
+	return nil
+}
+
+// schemaErrorMessage uses the short reason rather than Error(), which
+// includes the offending schema and value.
+func schemaErrorMessage(se *openapi3.SchemaError) string {
+	if se.SchemaField == "required" {
+		return "is required"
+	}
+	if se.Reason != "" {
+		return se.Reason
+	}
+
+	return fmt.Sprintf("does not match %q", se.SchemaField)
+}
+
+// bufferedResponse holds a response until it has been validated.
+type bufferedResponse struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.status = status
+		b.wroteHeader = true
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
+
+func (b *bufferedResponse) flush(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(b.status)
+	io.Copy(w, &b.body)
+}
@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+)
+
+// Rate allows Limit requests per Period, refilled continuously. Limit is
+// also the burst size.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// ParseRate parses "<limit>/<period>", e.g. "100/1m" or "5/30s".
+func ParseRate(s string) (Rate, error) {
+	limit, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("invalid rate %q", s)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil || n <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate limit %q", limit)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate period %q", period)
+	}
+
+	return Rate{Limit: n, Period: d}, nil
+}
+
+// LimitResult is the outcome of taking one token from a bucket.
+type LimitResult struct {
+	Allowed    bool
+	Remaining  int
+	Reset      time.Duration // until the bucket is full again
+	RetryAfter time.Duration // until the next token, when not allowed
+}
+
+// LimiterStore keeps token buckets. Implementations backed by shared
+// storage let several instances enforce one limit.
+type LimiterStore interface {
+	Take(key string, rate Rate, now time.Time) LimitResult
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// period is that of the bucket's rate, which is how long it takes to
+	// refill from empty.
+	period time.Duration
+}
+
+// MemoryLimiterStore keeps buckets in process memory.
+type MemoryLimiterStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	return &MemoryLimiterStore{buckets: map[string]*bucket{}}
+}
+
+func (m *MemoryLimiterStore) Take(key string, rate Rate, now time.Time) LimitResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	perSecond := float64(rate.Limit) / rate.Period.Seconds()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Limit), last: now, period: rate.Period}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(rate.Limit), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	b.period = rate.Period
+
+	result := LimitResult{}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((float64(rate.Limit) - b.tokens) / perSecond * float64(time.Second))
+
+	return result
+}
+
+// sweep drops buckets that have been idle for their own period, long
+// enough to be full again; they are indistinguishable from new ones.
+func (m *MemoryLimiterStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+
+	for k, b := range m.buckets {
+		if now.Sub(b.last) > b.period {
+			delete(m.buckets, k)
+		}
+	}
+}
+
+// RateLimiter applies token-bucket limits per route group and client.
+type RateLimiter struct {
+	store       LimiterStore
+	defaultRate Rate
+	groups      map[string]string // "METHOD /path" or "/path" -> group name
+	rates       map[string]Rate   // group name -> rate
+	key         func(*http.Request) string
+}
+
+// NewRateLimiter limits every request to defaultRate per key. key
+// identifies the client, typically the authenticated user or its IP.
+func NewRateLimiter(store LimiterStore, defaultRate Rate, key func(*http.Request) string) *RateLimiter {
+	return &RateLimiter{
+		store:       store,
+		defaultRate: defaultRate,
+		groups:      map[string]string{},
+		rates:       map[string]Rate{},
+		key:         key,
+	}
+}
+
+// AddGroup gives the listed routes their own, separately counted limit.
+// Routes are exact paths, optionally preceded by a method, as in
+// "POST /api/v2/users", for paths that other methods share.
+func (l *RateLimiter) AddGroup(name string, rate Rate, paths ...string) {
+	l.rates[name] = rate
+	for _, p := range paths {
+		l.groups[p] = name
+	}
+}
+
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		group, rate := "default", l.defaultRate
+		if g, ok := l.groups[r.Method+" "+r.URL.Path]; ok {
+			group, rate = g, l.rates[g]
+		} else if g, ok := l.groups[r.URL.Path]; ok {
+			group, rate = g, l.rates[g]
+		}
+
+		result := l.store.Take(group+"|"+l.key(r), rate, time.Now())
+
+		h := w.Header()
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rate.Limit, int(rate.Period.Seconds())))
+		h.Set("RateLimit-Limit", strconv.Itoa(rate.Limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			apierror.Write(w, r, apierror.New(apierror.KindTooManyRequests, apierror.CodeTooManyRequests, "Too many requests"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,159 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Rate
+		ok   bool
+	}{
+		{"100/1m", Rate{Limit: 100, Period: time.Minute}, true},
+		{" 5 / 30s ", Rate{Limit: 5, Period: 30 * time.Second}, true},
+		{"100", Rate{}, false},
+		{"0/1m", Rate{}, false},
+		{"-1/1m", Rate{}, false},
+		{"5/0s", Rate{}, false},
+		{"5/minute", Rate{}, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseRate(%q) = %+v, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestMemoryLimiterStoreTake(t *testing.T) {
+	rate := Rate{Limit: 3, Period: 3 * time.Second}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// the takes run in order against one bucket
+	tests := []struct {
+		name       string
+		at         time.Duration
+		allowed    bool
+		remaining  int
+		reset      time.Duration
+		retryAfter time.Duration
+	}{
+		{name: "new bucket is full", at: 0, allowed: true, remaining: 2, reset: time.Second},
+		{name: "second", at: 0, allowed: true, remaining: 1, reset: 2 * time.Second},
+		{name: "last token", at: 0, allowed: true, remaining: 0, reset: 3 * time.Second},
+		{name: "empty", at: 0, allowed: false, remaining: 0, reset: 3 * time.Second, retryAfter: time.Second},
+		{name: "refilled one token", at: time.Second, allowed: true, remaining: 0, reset: 3 * time.Second},
+		{name: "refill stops at the limit", at: time.Hour, allowed: true, remaining: 2, reset: time.Second},
+	}
+
+	store := NewMemoryLimiterStore()
+	for _, tt := range tests {
+		got := store.Take("client", rate, start.Add(tt.at))
+		want := LimitResult{Allowed: tt.allowed, Remaining: tt.remaining, Reset: tt.reset, RetryAfter: tt.retryAfter}
+		if got != want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, want)
+		}
+	}
+
+	if got := store.Take("other", rate, start); !got.Allowed || got.Remaining != 2 {
+		t.Errorf("keys share a bucket: %+v", got)
+	}
+}
+
+func TestMemoryLimiterStoreSweep(t *testing.T) {
+	strict := Rate{Limit: 1, Period: time.Hour}
+	lenient := Rate{Limit: 100, Period: time.Minute}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// idle is how long after exhausting the strict bucket other traffic
+		// triggers a sweep
+		idle    time.Duration
+		dropped bool
+	}{
+		{name: "other traffic does not reset a longer period", idle: 2 * time.Minute, dropped: false},
+		{name: "bucket idle for its own period is dropped", idle: 2 * time.Hour, dropped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryLimiterStore()
+			store.Take("auth|client", strict, start)
+			store.Take("default|client", lenient, start.Add(tt.idle))
+
+			_, kept := store.buckets["auth|client"]
+			if kept == tt.dropped {
+				t.Errorf("strict bucket kept = %v after %s", kept, tt.idle)
+			}
+			if _, ok := store.buckets["default|client"]; !ok {
+				t.Error("bucket in use was swept")
+			}
+		})
+	}
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	limiter := NewRateLimiter(NewMemoryLimiterStore(), Rate{Limit: 2, Period: time.Minute},
+		func(r *http.Request) string { return r.Header.Get("X-Client") })
+	limiter.AddGroup("auth", Rate{Limit: 1, Period: time.Hour}, "/login", "POST /users")
+
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// the requests run in order against one limiter
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		client     string
+		status     int
+		limit      string
+		policy     string
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{name: "default", path: "/tasks", client: "a", status: http.StatusNoContent, limit: "2", policy: "2;w=60", remaining: "1", reset: "30"},
+		{name: "default last", path: "/tasks", client: "a", status: http.StatusNoContent, limit: "2", policy: "2;w=60", remaining: "0", reset: "60"},
+		{name: "default exhausted", path: "/tasks", client: "a", status: http.StatusTooManyRequests, limit: "2", policy: "2;w=60", remaining: "0", reset: "60", retryAfter: "30"},
+		{name: "group counted separately", path: "/login", client: "a", status: http.StatusNoContent, limit: "1", policy: "1;w=3600", remaining: "0", reset: "3600"},
+		{name: "group exhausted", path: "/login", client: "a", status: http.StatusTooManyRequests, limit: "1", policy: "1;w=3600", remaining: "0", reset: "3600", retryAfter: "3600"},
+		{name: "method-specific route", method: http.MethodPost, path: "/users", client: "c", status: http.StatusNoContent, limit: "1", policy: "1;w=3600", remaining: "0", reset: "3600"},
+		{name: "other methods use the default", method: http.MethodGet, path: "/users", client: "c", status: http.StatusNoContent, limit: "2", policy: "2;w=60", remaining: "1", reset: "30"},
+		{name: "other client", path: "/login", client: "b", status: http.StatusNoContent, limit: "1", policy: "1;w=3600", remaining: "0", reset: "3600"},
+	}
+
+	for _, tt := range tests {
+		method := tt.method
+		if method == "" {
+			method = http.MethodPost
+		}
+		r := httptest.NewRequest(method, tt.path, nil)
+		r.Header.Set("X-Client", tt.client)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		h := w.Header()
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+		for name, want := range map[string]string{
+			"RateLimit-Policy":    tt.policy,
+			"RateLimit-Limit":     tt.limit,
+			"RateLimit-Remaining": tt.remaining,
+			"RateLimit-Reset":     tt.reset,
+			"Retry-After":         tt.retryAfter,
+		} {
+			if got := h.Get(name); got != want {
+				t.Errorf("%s: %s = %q, want %q", tt.name, name, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/logging"
+)
+
+// Recover turns a panic in a handler into a problem+json 500 response
+// instead of dropping the connection.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newResponseRecorder(w)
+
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// let the server abort the response as it normally would
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+
+			logging.FromContext(r.Context()).Error("panic serving request",
+				slog.Any("panic", err),
+				slog.String("stack", string(debug.Stack())),
+			)
+
+			if !rec.wroteHeader {
+				apierror.Write(rec, r, apierror.Internal(nil))
+			}
+		}()
+
+		next.ServeHTTP(rec, r)
+	})
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+)
+
+func TestRecover(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		panics  bool
+		// problem is whether the response is the problem+json 500
+		problem bool
+	}{
+		{name: "panic", status: http.StatusInternalServerError, panics: true, problem: true,
+			handler: func(w http.ResponseWriter, r *http.Request) { panic("boom") }},
+		{name: "panic with an error", status: http.StatusInternalServerError, panics: true, problem: true,
+			handler: func(w http.ResponseWriter, r *http.Request) { panic(http.ErrBodyNotAllowed) }},
+		{name: "panic after the header was sent", status: http.StatusAccepted, panics: true,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				panic("boom")
+			}},
+		{name: "no panic", status: http.StatusNoContent,
+			handler: func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+
+			handler := Chain(tt.handler, RequestID, AccessLog, Recover)
+			r := httptest.NewRequest(http.MethodGet, "/things", nil)
+			r.Header.Set(RequestIDHeader, "abc")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+
+			var logged, status any
+			for _, line := range logs() {
+				switch line["msg"] {
+				case "panic serving request":
+					logged = line["panic"]
+					if line["request_id"] != "abc" || line["stack"] == "" {
+						t.Errorf("panic logged without request ID or stack: %v", line)
+					}
+				case "request":
+					status = line["status"]
+				}
+			}
+			if (logged != nil) != tt.panics {
+				t.Errorf("panic logged as %v", logged)
+			}
+			if status != float64(tt.status) {
+				t.Errorf("access log status = %v, want %d", status, tt.status)
+			}
+
+			if !tt.problem {
+				return
+			}
+			if ct := w.Header().Get("Content-Type"); ct != apierror.ContentType {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var problem apierror.Problem
+			if err := json.NewDecoder(w.Body).Decode(&problem); err != nil {
+				t.Fatal(err)
+			}
+			if problem.Status != http.StatusInternalServerError || problem.RequestID != "abc" || problem.Instance != "/things" {
+				t.Errorf("got %+v", problem)
+			}
+			if problem.Detail == "boom" {
+				t.Error("panic value leaked into the response")
+			}
+		})
+	}
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler passed on", err)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/logging"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the
+// test and returns a function that decodes the lines written so far.
+func captureLogs(t *testing.T) func() []map[string]any {
+	t.Helper()
+
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	return func() []map[string]any {
+		var lines []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var entry map[string]any
+			if err := json.Unmarshal([]byte(line), &entry); err != nil {
+				t.Fatalf("log line %q: %v", line, err)
+			}
+			lines = append(lines, entry)
+		}
+		return lines
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+	tests := []struct {
+		name string
+		sent string
+		// kept is whether the sent ID is used rather than a generated one
+		kept bool
+	}{
+		{name: "accepted", sent: "req-123_abc.DEF", kept: true},
+		{name: "generated when missing"},
+		{name: "replaced when too long", sent: strings.Repeat("a", 129)},
+		{name: "longest accepted", sent: strings.Repeat("a", 128), kept: true},
+		{name: "replaced when it could forge log lines", sent: "abc\ninjected=1"},
+		{name: "replaced when it has spaces", sent: "abc def"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := captureLogs(t)
+
+			var seen string
+			handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestIDFromContext(r.Context())
+				logging.FromContext(r.Context()).Info("handled")
+				w.WriteHeader(http.StatusNoContent)
+			}), RequestID, AccessLog)
+
+			r := httptest.NewRequest(http.MethodGet, "/things", nil)
+			if tt.sent != "" {
+				r.Header.Set(RequestIDHeader, tt.sent)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			id := w.Header().Get(RequestIDHeader)
+			if tt.kept && id != tt.sent {
+				t.Fatalf("echoed %q, want %q", id, tt.sent)
+			}
+			if !tt.kept && !generated.MatchString(id) {
+				t.Fatalf("echoed %q, want a generated ID", id)
+			}
+			if seen != id {
+				t.Errorf("handler saw %q, want %q", seen, id)
+			}
+
+			lines := logs()
+			if len(lines) != 2 {
+				t.Fatalf("got %d log lines, want 2: %v", len(lines), lines)
+			}
+			for _, line := range lines {
+				if line["request_id"] != id {
+					t.Errorf("%s logged with request_id %v, want %s", line["msg"], line["request_id"], id)
+				}
+			}
+		})
+	}
+
+	// IDs are generated per request
+	handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	a, b := httptest.NewRecorder(), httptest.NewRecorder()
+	handler.ServeHTTP(a, httptest.NewRequest(http.MethodGet, "/", nil))
+	handler.ServeHTTP(b, httptest.NewRequest(http.MethodGet, "/", nil))
+	if a.Header().Get(RequestIDHeader) == b.Header().Get(RequestIDHeader) {
+		t.Error("two requests got the same ID")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	logs := captureLogs(t)
+
+	handler := Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}), RequestID, AccessLog)
+
+	r := httptest.NewRequest(http.MethodPost, "/things?secret=1", nil)
+	r.Header.Set(RequestIDHeader, "abc")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	lines := logs()
+	if len(lines) != 1 {
+		t.Fatalf("got %d log lines, want 1", len(lines))
+	}
+	line := lines[0]
+	want := map[string]any{
+		"msg":        "request",
+		"request_id": "abc",
+		"method":     "POST",
+		"path":       "/things", // without the query, which may carry secrets
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(5),
+	}
+	for k, v := range want {
+		if line[k] != v {
+			t.Errorf("%s = %v, want %v", k, line[k], v)
+		}
+	}
+	if _, ok := line["latency"]; !ok {
+		t.Error("latency not logged")
+	}
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/logging"
+	"github.com/AriJaya07/go-rest-api/packages/metrics"
+	"github.com/gorilla/mux"
+)
+
+// APIVersionHeader names the API version that served a response.
+const APIVersionHeader = "API-Version"
+
+type VersionConfig struct {
+	// Prefix is where versions are mounted; version v lives at Prefix/v.
+	Prefix string
+	// Versions lists the mounted versions, e.g. "v1" and "v2".
+	Versions []string
+	// Default serves unversioned requests that do not ask for a version.
+	Default string
+	// MediaType is the vendor media type clients may put in Accept.
+	// MediaType + ".v2+json" asks for v2.
+	MediaType string
+}
+
+// APIVersion serves unversioned paths under Prefix from the version the
+// client asks for in Accept, as the vendor media type or as a version
+// parameter ("application/json; version=2"), or from Default. The path is
+// rewritten before routing, so everything after this middleware sees the
+// versioned path. A version in the path always wins over Accept. Asking for
+// a version that is not mounted gets 406.
+func APIVersion(cfg VersionConfig) (Middleware, error) {
+	if !slices.Contains(cfg.Versions, cfg.Default) {
+		return nil, fmt.Errorf("default API version %q is not one of %v", cfg.Default, cfg.Versions)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rest, ok := strings.CutPrefix(r.URL.Path, cfg.Prefix+"/")
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if segment, _, _ := strings.Cut(rest, "/"); slices.Contains(cfg.Versions, segment) {
+				w.Header().Set(APIVersionHeader, segment)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// the response depends on Accept from here on
+			w.Header().Add("Vary", "Accept")
+
+			version, ok := cfg.fromAccept(r.Header.Values("Accept"))
+			if !ok {
+				apierror.Write(w, r, apierror.New(apierror.KindNotAcceptable, "unsupported_version",
+					fmt.Sprintf("Requested API version %q is not available; use one of %s", version, strings.Join(cfg.Versions, ", "))))
+				return
+			}
+			if version == "" {
+				version = cfg.Default
+			}
+			w.Header().Set(APIVersionHeader, version)
+
+			// as http.StripPrefix does, leave the caller's request alone
+			r2 := new(http.Request)
+			*r2 = *r
+			r2.URL = new(url.URL)
+			*r2.URL = *r.URL
+			r2.URL.Path = cfg.Prefix + "/" + version + "/" + rest
+			r2.URL.RawPath = ""
+
+			next.ServeHTTP(w, r2)
+		})
+	}, nil
+}
+
+// fromAccept returns the first version named in the Accept headers, or ""
+// when none is. ok is false when the named version is not mounted.
+func (cfg VersionConfig) fromAccept(values []string) (version string, ok bool) {
+	for _, value := range values {
+		for _, mediaRange := range strings.Split(value, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil {
+				continue
+			}
+
+			if v, found := strings.CutPrefix(mediaType, cfg.MediaType+"."); found {
+				version = strings.TrimSuffix(v, "+json")
+			} else if v := params["version"]; v != "" {
+				version = "v" + strings.TrimPrefix(v, "v")
+			} else {
+				continue
+			}
+
+			return version, slices.Contains(cfg.Versions, version)
+		}
+	}
+
+	return "", true
+}
+
+// Deprecation describes a route that is being phased out.
+type Deprecation struct {
+	// Since is when the route was deprecated.
+	Since time.Time
+	// Sunset is when the route will stop working. Zero if not yet decided.
+	Sunset time.Time
+	// Successor is the path template of the route replacing this one. Its
+	// {variables} are filled in from the request.
+	Successor string
+}
+
+// Deprecated is a mux middleware that marks responses from the listed
+// routes, keyed by "METHOD /path/template", with Deprecation (RFC 9745),
+// Sunset (RFC 8594) and successor-version Link headers. Each call is logged
+// and counted so we can tell when clients have migrated. It must run after
+// RouteTemplate.
+func Deprecated(routes map[string]Deprecation) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := RouteFromContext(r)
+			d, ok := routes[r.Method+" "+route]
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+			if !d.Sunset.IsZero() {
+				h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+			}
+
+			successor := d.Successor
+			if successor != "" {
+				for name, value := range mux.Vars(r) {
+					successor = strings.ReplaceAll(successor, "{"+name+"}", url.PathEscape(value))
+				}
+				h.Add("Link", "<"+successor+`>; rel="successor-version"`)
+			}
+
+			metrics.DeprecatedRequests.WithLabelValues(r.Method, route).Inc()
+			logging.FromContext(r.Context()).Warn("deprecated route called",
+				slog.String("route", route),
+				slog.String("successor", successor),
+				slog.String("user_agent", r.UserAgent()),
+			)
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+)
+
+// notFound turns a missing row into a typed 404 so handlers need not
+// inspect database errors.
+func notFound(err error, code, detail string) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return apierror.NotFound(code, detail).Wrap(err)
+	}
+	return err
+}
+
+// duplicate turns a unique key violation into a typed 409.
+func duplicate(err error, code, detail string) error {
+	if apierror.IsDuplicateKey(err) {
+		return apierror.Conflict(code, detail).Wrap(err)
+	}
+	return err
+}
+
+// referenced turns deleting a row that others still point at into a typed
+// 409.
+func referenced(err error, detail string) error {
+	if apierror.IsReferenced(err) {
+		return apierror.Conflict(apierror.CodeInUse, detail).Wrap(err)
+	}
+	return err
+}
+
+// versioned reports a 412 when a write guarded by the version the row was
+// read at matched no rows: another request has changed or deleted it since.
+func versioned(result sql.Result, detail string) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return apierror.PreconditionFailed(detail)
+	}
+	return nil
+}
+
+// now is the time writes record in updatedAt, at the column's precision.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/metrics"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+	"github.com/AriJaya07/go-rest-api/packages/tracing"
+)
+
+// InstrumentedStore wraps a Store and records a span, latency and errors
+// for every method call.
+type InstrumentedStore struct {
+	next Store
+}
+
+func NewInstrumentedStore(next Store) *InstrumentedStore {
+	return &InstrumentedStore{next: next}
+}
+
+// start opens a span for a Store method and returns a function that ends
+// it and records the call's latency and outcome.
+func (s *InstrumentedStore) start(ctx context.Context, method string) (context.Context, func(*error)) {
+	ctx, span := tracing.Tracer().Start(ctx, "store."+method, trace.WithAttributes(attribute.String("store.method", method)))
+	start := time.Now()
+
+	return ctx, func(err *error) {
+		metrics.StoreDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+
+		// missing rows and conflicts are expected outcomes, not database
+		// failures
+		if err != nil && *err != nil && apierror.KindOf(*err) == apierror.KindInternal {
+			metrics.StoreErrors.WithLabelValues(method).Inc()
+			span.RecordError(*err)
+			span.SetStatus(codes.Error, (*err).Error())
+		}
+		span.End()
+	}
+}
+
+func (s *InstrumentedStore) Close() error {
+	return s.next.Close()
+}
+
+func (s *InstrumentedStore) Ping(ctx context.Context) (err error) {
+	ctx, end := s.start(ctx, "Ping")
+	defer end(&err)
+	return s.next.Ping(ctx)
+}
+
+func (s *InstrumentedStore) SchemaVersion(ctx context.Context) (version int, err error) {
+	ctx, end := s.start(ctx, "SchemaVersion")
+	defer end(&err)
+	return s.next.SchemaVersion(ctx)
+}
+
+func (s *InstrumentedStore) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, end := s.start(ctx, "QueryRow")
+	defer end(nil)
+	return s.next.QueryRow(ctx, query, args...)
+}
+
+func (s *InstrumentedStore) ListUsers(ctx context.Context, f types.UserFilter, opts types.ListOptions) (items []types.User, next *types.Cursor, err error) {
+	ctx, end := s.start(ctx, "ListUsers")
+	defer end(&err)
+	return s.next.ListUsers(ctx, f, opts)
+}
+
+func (s *InstrumentedStore) CreateUser(ctx context.Context, u *types.User) (user *types.User, err error) {
+	ctx, end := s.start(ctx, "CreateUser")
+	defer end(&err)
+	return s.next.CreateUser(ctx, u)
+}
+
+func (s *InstrumentedStore) GetUserByID(ctx context.Context, id string) (user *types.User, err error) {
+	ctx, end := s.start(ctx, "GetUserByID")
+	defer end(&err)
+	return s.next.GetUserByID(ctx, id)
+}
+
+func (s *InstrumentedStore) GetUserByEmail(ctx context.Context, email string) (user *types.User, err error) {
+	ctx, end := s.start(ctx, "GetUserByEmail")
+	defer end(&err)
+	return s.next.GetUserByEmail(ctx, email)
+}
+
+func (s *InstrumentedStore) GetUserByIdentity(ctx context.Context, issuer, subject string) (user *types.User, err error) {
+	ctx, end := s.start(ctx, "GetUserByIdentity")
+	defer end(&err)
+	return s.next.GetUserByIdentity(ctx, issuer, subject)
+}
+
+func (s *InstrumentedStore) LinkIdentity(ctx context.Context, userID int64, issuer, subject string) (err error) {
+	ctx, end := s.start(ctx, "LinkIdentity")
+	defer end(&err)
+	return s.next.LinkIdentity(ctx, userID, issuer, subject)
+}
+
+func (s *InstrumentedStore) UpdateUser(ctx context.Context, user *types.User) (err error) {
+	ctx, end := s.start(ctx, "UpdateUser")
+	defer end(&err)
+	return s.next.UpdateUser(ctx, user)
+}
+
+func (s *InstrumentedStore) UpdatePassword(ctx context.Context, user *types.User) (err error) {
+	ctx, end := s.start(ctx, "UpdatePassword")
+	defer end(&err)
+	return s.next.UpdatePassword(ctx, user)
+}
+
+func (s *InstrumentedStore) UpdateUserRole(ctx context.Context, user *types.User) (err error) {
+	ctx, end := s.start(ctx, "UpdateUserRole")
+	defer end(&err)
+	return s.next.UpdateUserRole(ctx, user)
+}
+
+func (s *InstrumentedStore) DeleteUser(ctx context.Context, id int64, version int64) (err error) {
+	ctx, end := s.start(ctx, "DeleteUser")
+	defer end(&err)
+	return s.next.DeleteUser(ctx, id, version)
+}
+
+func (s *InstrumentedStore) GetTOTP(ctx context.Context, userID int64) (t *types.TOTP, err error) {
+	ctx, end := s.start(ctx, "GetTOTP")
+	defer end(&err)
+	return s.next.GetTOTP(ctx, userID)
+}
+
+func (s *InstrumentedStore) SaveTOTP(ctx context.Context, t *types.TOTP) (err error) {
+	ctx, end := s.start(ctx, "SaveTOTP")
+	defer end(&err)
+	return s.next.SaveTOTP(ctx, t)
+}
+
+func (s *InstrumentedStore) ConfirmTOTP(ctx context.Context, userID int64, step int64) (err error) {
+	ctx, end := s.start(ctx, "ConfirmTOTP")
+	defer end(&err)
+	return s.next.ConfirmTOTP(ctx, userID, step)
+}
+
+func (s *InstrumentedStore) UpdateTOTPStep(ctx context.Context, userID int64, step int64) (ok bool, err error) {
+	ctx, end := s.start(ctx, "UpdateTOTPStep")
+	defer end(&err)
+	return s.next.UpdateTOTPStep(ctx, userID, step)
+}
+
+func (s *InstrumentedStore) DeleteTOTP(ctx context.Context, userID int64) (err error) {
+	ctx, end := s.start(ctx, "DeleteTOTP")
+	defer end(&err)
+	return s.next.DeleteTOTP(ctx, userID)
+}
+
+func (s *InstrumentedStore) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) (err error) {
+	ctx, end := s.start(ctx, "ReplaceRecoveryCodes")
+	defer end(&err)
+	return s.next.ReplaceRecoveryCodes(ctx, userID, hashes)
+}
+
+func (s *InstrumentedStore) UseRecoveryCode(ctx context.Context, userID int64, hash string) (ok bool, err error) {
+	ctx, end := s.start(ctx, "UseRecoveryCode")
+	defer end(&err)
+	return s.next.UseRecoveryCode(ctx, userID, hash)
+}
+
+func (s *InstrumentedStore) ListProjects(ctx context.Context, f types.ProjectFilter, opts types.ListOptions) (items []types.Project, next *types.Cursor, err error) {
+	ctx, end := s.start(ctx, "ListProjects")
+	defer end(&err)
+	return s.next.ListProjects(ctx, f, opts)
+}
+
+func (s *InstrumentedStore) CreateProject(ctx context.Context, p *types.Project) (err error) {
+	ctx, end := s.start(ctx, "CreateProject")
+	defer end(&err)
+	return s.next.CreateProject(ctx, p)
+}
+
+func (s *InstrumentedStore) GetProject(ctx context.Context, id string) (p *types.Project, err error) {
+	ctx, end := s.start(ctx, "GetProject")
+	defer end(&err)
+	return s.next.GetProject(ctx, id)
+}
+
+func (s *InstrumentedStore) UpdateProject(ctx context.Context, project *types.Project) (err error) {
+	ctx, end := s.start(ctx, "UpdateProject")
+	defer end(&err)
+	return s.next.UpdateProject(ctx, project)
+}
+
+func (s *InstrumentedStore) DeleteProject(ctx context.Context, id string, version int64) (err error) {
+	ctx, end := s.start(ctx, "DeleteProject")
+	defer end(&err)
+	return s.next.DeleteProject(ctx, id, version)
+}
+
+func (s *InstrumentedStore) CreateTask(ctx context.Context, t *types.Task) (task *types.Task, err error) {
+	ctx, end := s.start(ctx, "CreateTask")
+	defer end(&err)
+	return s.next.CreateTask(ctx, t)
+}
+
+func (s *InstrumentedStore) GetTask(ctx context.Context, id string) (t *types.Task, err error) {
+	ctx, end := s.start(ctx, "GetTask")
+	defer end(&err)
+	return s.next.GetTask(ctx, id)
+}
+
+func (s *InstrumentedStore) UpdateTask(ctx context.Context, t *types.Task) (err error) {
+	ctx, end := s.start(ctx, "UpdateTask")
+	defer end(&err)
+	return s.next.UpdateTask(ctx, t)
+}
+
+func (s *InstrumentedStore) ListTasks(ctx context.Context, f types.TaskFilter, opts types.ListOptions) (items []types.Task, next *types.Cursor, err error) {
+	ctx, end := s.start(ctx, "ListTasks")
+	defer end(&err)
+	return s.next.ListTasks(ctx, f, opts)
+}
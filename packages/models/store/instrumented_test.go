@@ -0,0 +1,100 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/models/store"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+// failingStore returns its errors from the methods the test calls.
+type failingStore struct {
+	store.Store
+	pingErr    error
+	projectErr error
+}
+
+func (s *failingStore) Ping(ctx context.Context) error {
+	return s.pingErr
+}
+
+func (s *failingStore) GetProject(ctx context.Context, id string) (*types.Project, error) {
+	return nil, s.projectErr
+}
+
+func TestInstrumentedStoreSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(prev)
+
+	errDown := errors.New("connection refused")
+	ping := func(s *store.InstrumentedStore) { s.Ping(context.Background()) }
+
+	tests := []struct {
+		name   string
+		next   *failingStore
+		call   func(s *store.InstrumentedStore)
+		span   string
+		failed bool
+	}{
+		{name: "database failure", next: &failingStore{pingErr: errDown}, call: ping, span: "store.Ping", failed: true},
+		{name: "success", next: &failingStore{}, call: ping, span: "store.Ping"},
+		{name: "missing row is not a failure", span: "store.GetProject",
+			next: &failingStore{projectErr: apierror.NotFound("project_not_found", "Project not found")},
+			call: func(s *store.InstrumentedStore) { s.GetProject(context.Background(), "7") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			tt.call(store.NewInstrumentedStore(tt.next))
+
+			spans := exporter.GetSpans()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			span := spans[0]
+			if span.Name != tt.span {
+				t.Errorf("span %q, want %q", span.Name, tt.span)
+			}
+			method := tt.span[len("store."):]
+			if !hasAttribute(span.Attributes, attribute.String("store.method", method)) {
+				t.Errorf("attributes %v lack store.method=%s", span.Attributes, method)
+			}
+
+			if !tt.failed {
+				if span.Status.Code != codes.Unset || len(span.Events) != 0 {
+					t.Errorf("status %v with events %v, want neither", span.Status, span.Events)
+				}
+				return
+			}
+			if span.Status.Code != codes.Error || span.Status.Description != errDown.Error() {
+				t.Errorf("status = %+v", span.Status)
+			}
+			if len(span.Events) != 1 || span.Events[0].Name != "exception" ||
+				!hasAttribute(span.Events[0].Attributes, attribute.String("exception.message", errDown.Error())) {
+				t.Errorf("error not recorded: %+v", span.Events)
+			}
+		})
+	}
+}
+
+func hasAttribute(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, a := range attrs {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
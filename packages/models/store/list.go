@@ -0,0 +1,196 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+type columnKind int
+
+const (
+	intColumn columnKind = iota
+	stringColumn
+	timeColumn
+)
+
+// sortColumn is a column lists may be ordered by.
+type sortColumn struct {
+	name string
+	kind columnKind
+}
+
+// Sortable fields of each list, by the name clients use. Enum columns are
+// left out: MySQL orders them by position but compares them as strings,
+// which would break cursors.
+var (
+	userSorts = map[string]sortColumn{
+		"id":        {"id", intColumn},
+		"email":     {"email", stringColumn},
+		"firstName": {"firstName", stringColumn},
+		"lastName":  {"lastName", stringColumn},
+		"createdAt": {"createdAt", timeColumn},
+	}
+	projectSorts = map[string]sortColumn{
+		"id":        {"id", intColumn},
+		"name":      {"name", stringColumn},
+		"createdAt": {"createdAt", timeColumn},
+	}
+	taskSorts = map[string]sortColumn{
+		"id":        {"id", intColumn},
+		"name":      {"name", stringColumn},
+		"createdAt": {"createdAt", timeColumn},
+	}
+)
+
+// listQuery is a SELECT that list pages through by keyset: each page
+// continues after the sort value and ID of the last row of the previous one,
+// so rows added or removed meanwhile do not shift the pages.
+type listQuery struct {
+	columns string
+	from    string
+	sorts   map[string]sortColumn
+	where   []string
+	args    []any
+}
+
+func (q *listQuery) filter(cond string, args ...any) {
+	q.where = append(q.where, cond)
+	q.args = append(q.args, args...)
+}
+
+// contains matches s anywhere in any of the columns.
+func (q *listQuery) contains(s string, columns ...string) {
+	if s == "" {
+		return
+	}
+
+	pattern := "%" + likeEscaper.Replace(s) + "%"
+	conds := make([]string, len(columns))
+	args := make([]any, len(columns))
+	for i, column := range columns {
+		conds[i] = column + " LIKE ?"
+		args[i] = pattern
+	}
+	q.filter("("+strings.Join(conds, " OR ")+")", args...)
+}
+
+func (q *listQuery) createdBetween(after, before time.Time) {
+	if !after.IsZero() {
+		q.filter("createdAt >= ?", after)
+	}
+	if !before.IsZero() {
+		q.filter("createdAt < ?", before)
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// list runs q for the page opts selects. dest returns where to scan the
+// selected columns of a row. The returned cursor is nil on the last page.
+func list[T any](ctx context.Context, s *Storage, q listQuery, opts types.ListOptions, dest func(*T) []any) ([]T, *types.Cursor, error) {
+	sort, ok := q.sorts[opts.Sort]
+	if !ok {
+		fields := make([]string, 0, len(q.sorts))
+		for field := range q.sorts {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+		return nil, nil, apierror.Validation("Request validation failed", map[string][]string{
+			"sort": {"must be one of: " + strings.Join(fields, ", ")},
+		})
+	}
+
+	op, dir := ">", "ASC"
+	if opts.Desc {
+		op, dir = "<", "DESC"
+	}
+
+	if opts.After != nil {
+		value, err := sort.parse(opts.After.Value)
+		if err != nil {
+			return nil, nil, apierror.BadRequest("invalid_cursor", "Cursor is not valid").Wrap(err)
+		}
+		if sort.name == "id" {
+			q.filter("id "+op+" ?", opts.After.ID)
+		} else {
+			q.filter(fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sort.name, op), value, value, opts.After.ID)
+		}
+	}
+
+	query := "SELECT " + q.columns + ", " + sort.name + ", id FROM " + q.from
+	if len(q.where) > 0 {
+		query += " WHERE " + strings.Join(q.where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s", sort.name, dir)
+	if sort.name != "id" {
+		query += ", id " + dir
+	}
+	// one extra row tells us whether there is another page
+	query += " LIMIT ?"
+
+	rows, err := s.query(ctx, query, append(q.args, opts.Limit+1)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var (
+		items     = []T{}
+		next      *types.Cursor
+		lastValue any
+		lastID    int64
+	)
+	for rows.Next() {
+		if len(items) == opts.Limit {
+			next = &types.Cursor{Sort: opts.Sort, Desc: opts.Desc, Value: cursorValue(lastValue), ID: lastID}
+			break
+		}
+
+		var item T
+		if err := rows.Scan(append(dest(&item), &lastValue, &lastID)...); err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return items, next, nil
+}
+
+// cursorValue makes a scanned sort value safe to round-trip through JSON.
+func cursorValue(v any) any {
+	switch v := v.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+// parse reads a cursor value decoded from JSON back into a query argument.
+func (c sortColumn) parse(v any) (any, error) {
+	switch c.kind {
+	case intColumn:
+		if n, ok := v.(float64); ok {
+			return int64(n), nil
+		}
+	case stringColumn:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case timeColumn:
+		if s, ok := v.(string); ok {
+			return time.Parse(time.RFC3339Nano, s)
+		}
+	}
+	return nil, fmt.Errorf("cursor value %v does not fit column %s", v, c.name)
+}
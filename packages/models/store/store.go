@@ -1,8 +1,8 @@
 package store
 
 import (
+	"context"
 	"database/sql"
-	"log"
 
 	"github.com/AriJaya07/go-rest-api/packages/models/types"
 )
@@ -12,23 +12,40 @@ type Storage struct {
 }
 
 type Store interface {
+	Close() error
+	Ping(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (int, error)
 	// Users
-	GetAllUsers() ([]types.User, error)
-	QueryRow(query string, args ...interface{}) *sql.Row
-	CreateUser(u *types.User) (*types.User, error)
-	GetUserByID(id string) (*types.User, error)
-	UpdateUser(user *types.User) error
-	UpdatePassword(user *types.User) error
-	DeleteUser(id int64) error
+	ListUsers(ctx context.Context, f types.UserFilter, opts types.ListOptions) ([]types.User, *types.Cursor, error)
+	QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row
+	CreateUser(ctx context.Context, u *types.User) (*types.User, error)
+	GetUserByID(ctx context.Context, id string) (*types.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*types.User, error)
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (*types.User, error)
+	LinkIdentity(ctx context.Context, userID int64, issuer, subject string) error
+	UpdateUser(ctx context.Context, user *types.User) error
+	UpdatePassword(ctx context.Context, user *types.User) error
+	UpdateUserRole(ctx context.Context, user *types.User) error
+	DeleteUser(ctx context.Context, id int64, version int64) error
+	// Two-factor authentication
+	GetTOTP(ctx context.Context, userID int64) (*types.TOTP, error)
+	SaveTOTP(ctx context.Context, t *types.TOTP) error
+	ConfirmTOTP(ctx context.Context, userID int64, step int64) error
+	UpdateTOTPStep(ctx context.Context, userID int64, step int64) (bool, error)
+	DeleteTOTP(ctx context.Context, userID int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error)
 	// Projects
-	GetAllProjects() ([]types.Project, error)
-	CreateProject(p *types.Project) error
-	GetProject(id string) (*types.Project, error)
-	UpdateProject(project *types.Project) error
-	DeleteProject(id string) error
+	ListProjects(ctx context.Context, f types.ProjectFilter, opts types.ListOptions) ([]types.Project, *types.Cursor, error)
+	CreateProject(ctx context.Context, p *types.Project) error
+	GetProject(ctx context.Context, id string) (*types.Project, error)
+	UpdateProject(ctx context.Context, project *types.Project) error
+	DeleteProject(ctx context.Context, id string, version int64) error
 	// Tasks
-	CreateTask(t *types.Task) (*types.Task, error)
-	GetTask(id string) (*types.Task, error)
+	CreateTask(ctx context.Context, t *types.Task) (*types.Task, error)
+	GetTask(ctx context.Context, id string) (*types.Task, error)
+	UpdateTask(ctx context.Context, t *types.Task) error
+	ListTasks(ctx context.Context, f types.TaskFilter, opts types.ListOptions) ([]types.Task, *types.Cursor, error)
 }
 
 func NewStore(db *sql.DB) *Storage {
@@ -37,41 +54,52 @@ func NewStore(db *sql.DB) *Storage {
 	}
 }
 
-func (s *Storage) QueryRow(query string, args ...interface{}) *sql.Row {
-	return s.db.QueryRow(query, args...)
+// Close closes the underlying connection pool.
+func (s *Storage) Close() error {
+	return s.db.Close()
 }
 
-func (s *Storage) GetAllUsers() ([]types.User, error) {
-	var users []types.User
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
 
-	rows, err := s.db.Query("SELECT * FROM users")
-	if err != nil {
-		log.Println("Error executing query:", err)
-		return nil, err
-	}
-	defer rows.Close()
+// SchemaVersion returns the latest applied migration.
+func (s *Storage) SchemaVersion(ctx context.Context) (int, error) {
+	var version int
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
 
-	for rows.Next() {
-		var u types.User
-		if err := rows.Scan(&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Password, &u.CreatedAt); err != nil {
-			log.Println("Error scanning row:", err)
-			return nil, err
-		}
-		users = append(users, u)
-	}
+func (s *Storage) QueryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return s.queryRow(ctx, query, args...)
+}
 
-	if err := rows.Err(); err != nil {
-		log.Println("Error after scanning rows:", err)
-		return nil, err
+func (s *Storage) ListUsers(ctx context.Context, f types.UserFilter, opts types.ListOptions) ([]types.User, *types.Cursor, error) {
+	q := listQuery{
+		columns: "id, email, firstName, lastName, password, role, version, createdAt, updatedAt",
+		from:    "users",
+		sorts:   userSorts,
 	}
+	q.contains(f.Name, "firstName", "lastName")
+	q.contains(f.Email, "email")
+	if f.Role != "" {
+		q.filter("role = ?", f.Role)
+	}
+	q.createdBetween(f.CreatedAfter, f.CreatedBefore)
 
-	return users, nil
+	return list(ctx, s, q, opts, func(u *types.User) []any {
+		return []any{&u.ID, &u.Email, &u.FirstName, &u.LastName, &u.Password, &u.Role, &u.Version, &u.CreatedAt, &u.UpdatedAt}
+	})
 }
 
-func (s *Storage) CreateUser(u *types.User) (*types.User, error) {
-	rows, err := s.db.Exec("INSERT INTO users (email, firstName, lastName, password) VALUES (?, ?, ?, ?)", u.Email, u.FirstName, u.LastName, u.Password)
+func (s *Storage) CreateUser(ctx context.Context, u *types.User) (*types.User, error) {
+	if u.Role == "" {
+		u.Role = types.RoleUser
+	}
+
+	rows, err := s.exec(ctx, "INSERT INTO users (email, firstName, lastName, password, role) VALUES (?, ?, ?, ?, ?)", u.Email, u.FirstName, u.LastName, u.Password, u.Role)
 	if err != nil {
-		return nil, err
+		return nil, duplicate(err, "email_taken", "A user with this email already exists")
 	}
 
 	id, err := rows.LastInsertId()
@@ -80,35 +108,72 @@ func (s *Storage) CreateUser(u *types.User) (*types.User, error) {
 	}
 
 	u.ID = id
+	u.Version = 1
 	return u, nil
 }
 
-func (s *Storage) UpdateUser(user *types.User) error {
+// UpdateUser saves user if it is still at user.Version, and moves it to
+// the next version.
+func (s *Storage) UpdateUser(ctx context.Context, user *types.User) error {
+	now := now()
+
 	// Prepare SQL statement
-	query := "UPDATE users SET firstName = ?, lastName = ?, email = ? WHERE id = ?"
+	query := "UPDATE users SET firstName = ?, lastName = ?, email = ?, version = version + 1, updatedAt = ? WHERE id = ? AND version = ?"
 
 	// Execute SQL statement
-	_, err := s.db.Exec(query, user.FirstName, user.LastName, user.Email, user.ID)
+	result, err := s.exec(ctx, query, user.FirstName, user.LastName, user.Email, now, user.ID, user.Version)
 	if err != nil {
+		return duplicate(err, "email_taken", "A user with this email already exists")
+	}
+	if err := versioned(result, "User was changed by another request"); err != nil {
 		return err
 	}
 
+	user.Version++
+	user.UpdatedAt = now
 	return nil
 }
 
-func (s *Storage) GetUserByID(id string) (*types.User, error) {
+func (s *Storage) GetUserByID(ctx context.Context, id string) (*types.User, error) {
 	var u types.User
-	err := s.db.QueryRow("SELECT id, email, password, firstName, lastName, createdAt FROM users WHERE id = ?", id).Scan(&u.ID, &u.Email, &u.Password, &u.FirstName, &u.LastName, &u.CreatedAt)
-	return &u, err
+	err := s.queryRow(ctx, "SELECT id, email, password, firstName, lastName, role, version, createdAt, updatedAt FROM users WHERE id = ?", id).Scan(&u.ID, &u.Email, &u.Password, &u.FirstName, &u.LastName, &u.Role, &u.Version, &u.CreatedAt, &u.UpdatedAt)
+	return &u, notFound(err, "user_not_found", "User not found")
 }
 
-func (s *Storage) DeleteUser(id int64) error {
-	_, err := s.db.Exec("DELETE FROM users WHERE id = ?", id)
-	return err
+func (s *Storage) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	var u types.User
+	err := s.queryRow(ctx, "SELECT id, email, password, firstName, lastName, role, version, createdAt, updatedAt FROM users WHERE email = ?", email).Scan(&u.ID, &u.Email, &u.Password, &u.FirstName, &u.LastName, &u.Role, &u.Version, &u.CreatedAt, &u.UpdatedAt)
+	return &u, notFound(err, "user_not_found", "User not found")
+}
+
+// GetUserByIdentity finds the user linked to an external identity provider
+// account.
+func (s *Storage) GetUserByIdentity(ctx context.Context, issuer, subject string) (*types.User, error) {
+	var u types.User
+	query := `SELECT u.id, u.email, u.password, u.firstName, u.lastName, u.role, u.version, u.createdAt, u.updatedAt
+		FROM users u JOIN user_identities i ON i.userId = u.id
+		WHERE i.issuer = ? AND i.subject = ?`
+	err := s.queryRow(ctx, query, issuer, subject).Scan(&u.ID, &u.Email, &u.Password, &u.FirstName, &u.LastName, &u.Role, &u.Version, &u.CreatedAt, &u.UpdatedAt)
+	return &u, notFound(err, "user_not_found", "User not found")
 }
 
-func (s *Storage) CreateProject(p *types.Project) error {
-	result, err := s.db.Exec("INSERT INTO projects (name) VALUES (?)", p.Name)
+func (s *Storage) LinkIdentity(ctx context.Context, userID int64, issuer, subject string) error {
+	_, err := s.exec(ctx, "INSERT INTO user_identities (userId, issuer, subject) VALUES (?, ?, ?)", userID, issuer, subject)
+	return duplicate(err, "identity_linked", "This identity is already linked to a user")
+}
+
+// DeleteUser deletes the user if it is still at version.
+func (s *Storage) DeleteUser(ctx context.Context, id int64, version int64) error {
+	result, err := s.exec(ctx, "DELETE FROM users WHERE id = ? AND version = ?", id, version)
+	if err != nil {
+		return referenced(err, "User still has tasks assigned")
+	}
+
+	return versioned(result, "User was changed by another request")
+}
+
+func (s *Storage) CreateProject(ctx context.Context, p *types.Project) error {
+	result, err := s.exec(ctx, "INSERT INTO projects (name) VALUES (?)", p.Name)
 	if err != nil {
 		return err
 	}
@@ -119,71 +184,95 @@ func (s *Storage) CreateProject(p *types.Project) error {
 	}
 
 	p.ID = id
+	p.Version = 1
 
 	return err
 }
 
-func (s *Storage) GetAllProjects() ([]types.Project, error) {
-	var projects []types.Project
-	rows, err := s.db.Query("SELECT * FROM projects")
-	if err != nil {
-		return nil, err
+func (s *Storage) ListProjects(ctx context.Context, f types.ProjectFilter, opts types.ListOptions) ([]types.Project, *types.Cursor, error) {
+	q := listQuery{
+		columns: "id, name, version, createdAt, updatedAt",
+		from:    "projects",
+		sorts:   projectSorts,
 	}
-	defer rows.Close()
+	q.contains(f.Name, "name")
+	q.createdBetween(f.CreatedAfter, f.CreatedBefore)
 
-	for rows.Next() {
-		var p types.Project
-		if err := rows.Scan(&p.ID, &p.Name, &p.CreatedAt); err != nil {
-			return nil, err
-		}
-		projects = append(projects, p)
-	}
+	return list(ctx, s, q, opts, func(p *types.Project) []any {
+		return []any{&p.ID, &p.Name, &p.Version, &p.CreatedAt, &p.UpdatedAt}
+	})
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, err
+func (s *Storage) UpdatePassword(ctx context.Context, user *types.User) error {
+	now := now()
+	query := "UPDATE users SET password = ?, version = version + 1, updatedAt = ? WHERE id = ? AND version = ?"
+	result, err := s.exec(ctx, query, user.Password, now, user.ID, user.Version)
+	if err != nil {
+		return err
+	}
+	if err := versioned(result, "User was changed by another request"); err != nil {
+		return err
 	}
 
-	return projects, nil
+	user.Version++
+	user.UpdatedAt = now
+	return nil
 }
 
-func (s *Storage) UpdatePassword(user *types.User) error {
-	query := "UPDATE users SET password = ? WHERE id = ?"
-	_, err := s.db.Exec(query, user.Password, user.ID)
+func (s *Storage) UpdateUserRole(ctx context.Context, user *types.User) error {
+	now := now()
+	query := "UPDATE users SET role = ?, version = version + 1, updatedAt = ? WHERE id = ? AND version = ?"
+	result, err := s.exec(ctx, query, user.Role, now, user.ID, user.Version)
 	if err != nil {
 		return err
 	}
+	if err := versioned(result, "User was changed by another request"); err != nil {
+		return err
+	}
+
+	user.Version++
+	user.UpdatedAt = now
 	return nil
 }
 
-func (s *Storage) GetProject(id string) (*types.Project, error) {
+func (s *Storage) GetProject(ctx context.Context, id string) (*types.Project, error) {
 	var p types.Project
-	query := "SELECT id, name, createdAt FROM projects WHERE id = ?"
-	err := s.db.QueryRow(query, id).Scan(&p.ID, &p.Name, &p.CreatedAt)
-	return &p, err
+	query := "SELECT id, name, version, createdAt, updatedAt FROM projects WHERE id = ?"
+	err := s.queryRow(ctx, query, id).Scan(&p.ID, &p.Name, &p.Version, &p.CreatedAt, &p.UpdatedAt)
+	return &p, notFound(err, "project_not_found", "Project not found")
 }
 
-func (s *Storage) UpdateProject(project *types.Project) error {
-	query := "UPDATE projects SET name = ? WHERE id = ?"
+// UpdateProject saves project if it is still at project.Version, and moves
+// it to the next version.
+func (s *Storage) UpdateProject(ctx context.Context, project *types.Project) error {
+	now := now()
+	query := "UPDATE projects SET name = ?, version = version + 1, updatedAt = ? WHERE id = ? AND version = ?"
 
-	_, err := s.db.Exec(query, project.Name, project.ID)
+	result, err := s.exec(ctx, query, project.Name, now, project.ID, project.Version)
 	if err != nil {
 		return err
 	}
+	if err := versioned(result, "Project was changed by another request"); err != nil {
+		return err
+	}
 
+	project.Version++
+	project.UpdatedAt = now
 	return nil
 }
 
-func (s *Storage) DeleteProject(id string) error {
-	_, err := s.db.Exec("DELETE FROM projects WHERE id = ?", id)
+// DeleteProject deletes the project if it is still at version.
+func (s *Storage) DeleteProject(ctx context.Context, id string, version int64) error {
+	result, err := s.exec(ctx, "DELETE FROM projects WHERE id = ? AND version = ?", id, version)
 	if err != nil {
-		return err
+		return referenced(err, "Project still has tasks")
 	}
 
-	return nil
+	return versioned(result, "Project was changed by another request")
 }
 
-func (s *Storage) CreateTask(t *types.Task) (*types.Task, error) {
-	rows, err := s.db.Exec("INSERT INTO tasks (name, status, project_id, assigned_to) VALUES (?, ?, ?, ?)", t.Name, t.Status, t.ProjectId, t.AssignedToID)
+func (s *Storage) CreateTask(ctx context.Context, t *types.Task) (*types.Task, error) {
+	rows, err := s.exec(ctx, "INSERT INTO tasks (name, status, projectId, assignedToID) VALUES (?, ?, ?, ?)", t.Name, t.Status, t.ProjectId, t.AssignedToID)
 
 	if err != nil {
 		return nil, err
@@ -195,11 +284,54 @@ func (s *Storage) CreateTask(t *types.Task) (*types.Task, error) {
 	}
 
 	t.ID = id
+	t.Version = 1
 	return t, nil
 }
 
-func (s *Storage) GetTask(id string) (*types.Task, error) {
+func (s *Storage) GetTask(ctx context.Context, id string) (*types.Task, error) {
 	var t types.Task
-	err := s.db.QueryRow("SELECT id, name, status, project_id, assigned_to, createdAt FROM tasks WHERE id = ?", id).Scan(&t.ID, &t.Name, &t.Status, &t.ProjectId, &t.AssignedToID, &t.CreatedAt)
-	return &t, err
+	err := s.queryRow(ctx, "SELECT id, name, status, projectId, assignedToID, version, createdAt, updatedAt FROM tasks WHERE id = ?", id).Scan(&t.ID, &t.Name, &t.Status, &t.ProjectId, &t.AssignedToID, &t.Version, &t.CreatedAt, &t.UpdatedAt)
+	return &t, notFound(err, "task_not_found", "Task not found")
+}
+
+// UpdateTask saves t if it is still at t.Version, and moves it to the next
+// version. A task cannot move to another project.
+func (s *Storage) UpdateTask(ctx context.Context, t *types.Task) error {
+	now := now()
+	query := "UPDATE tasks SET name = ?, status = ?, assignedToID = ?, version = version + 1, updatedAt = ? WHERE id = ? AND version = ?"
+
+	result, err := s.exec(ctx, query, t.Name, t.Status, t.AssignedToID, now, t.ID, t.Version)
+	if err != nil {
+		return err
+	}
+	if err := versioned(result, "Task was changed by another request"); err != nil {
+		return err
+	}
+
+	t.Version++
+	t.UpdatedAt = now
+	return nil
+}
+
+func (s *Storage) ListTasks(ctx context.Context, f types.TaskFilter, opts types.ListOptions) ([]types.Task, *types.Cursor, error) {
+	q := listQuery{
+		columns: "id, name, status, projectId, assignedToID, version, createdAt, updatedAt",
+		from:    "tasks",
+		sorts:   taskSorts,
+	}
+	q.contains(f.Name, "name")
+	if f.Status != "" {
+		q.filter("status = ?", f.Status)
+	}
+	if f.ProjectID != 0 {
+		q.filter("projectId = ?", f.ProjectID)
+	}
+	if f.AssignedToID != 0 {
+		q.filter("assignedToID = ?", f.AssignedToID)
+	}
+	q.createdBetween(f.CreatedAfter, f.CreatedBefore)
+
+	return list(ctx, s, q, opts, func(t *types.Task) []any {
+		return []any{&t.ID, &t.Name, &t.Status, &t.ProjectId, &t.AssignedToID, &t.Version, &t.CreatedAt, &t.UpdatedAt}
+	})
 }
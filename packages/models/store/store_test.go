@@ -1,6 +1,7 @@
 package store_test
 
 import (
+	"context"
 	"errors"
 
 	"github.com/AriJaya07/go-rest-api/packages/models/types"
@@ -10,34 +11,42 @@ import (
 
 type MockStore struct{}
 
-func (s *MockStore) CreateProject(p *types.Project) error {
+func (s *MockStore) CreateProject(ctx context.Context, p *types.Project) error {
 	return nil
 }
 
-func (ms *MockStore) GetAllProjects() ([]types.Project, error) {
-	return nil, errors.New("Not implemented")
+func (ms *MockStore) ListProjects(ctx context.Context, f types.ProjectFilter, opts types.ListOptions) ([]types.Project, *types.Cursor, error) {
+	return nil, nil, errors.New("Not implemented")
 }
 
-func (s *MockStore) GetProject(id string) (*types.Project, error) {
+func (s *MockStore) GetProject(ctx context.Context, id string) (*types.Project, error) {
 	return &types.Project{Name: "Super cool project"}, nil
 }
 
-func (s *MockStore) DeleteProject(id string) error {
+func (s *MockStore) DeleteProject(ctx context.Context, id string, version int64) error {
 	return nil
 }
 
-func (s *MockStore) CreateUser(u *types.User) (*types.User, error) {
+func (s *MockStore) CreateUser(ctx context.Context, u *types.User) (*types.User, error) {
 	return &types.User{}, nil
 }
 
-func (s *MockStore) GetUserByID(id string) (*types.User, error) {
+func (s *MockStore) GetUserByID(ctx context.Context, id string) (*types.User, error) {
 	return &types.User{}, nil
 }
 
-func (s *MockStore) CreateTask(t *types.Task) (*types.Task, error) {
+func (s *MockStore) CreateTask(ctx context.Context, t *types.Task) (*types.Task, error) {
 	return &types.Task{}, nil
 }
 
-func (s *MockStore) GetTask(id string) (*types.Task, error) {
+func (s *MockStore) GetTask(ctx context.Context, id string) (*types.Task, error) {
 	return &types.Task{}, nil
 }
+
+func (s *MockStore) UpdateTask(ctx context.Context, t *types.Task) error {
+	return nil
+}
+
+func (s *MockStore) ListTasks(ctx context.Context, f types.TaskFilter, opts types.ListOptions) ([]types.Task, *types.Cursor, error) {
+	return nil, nil, nil
+}
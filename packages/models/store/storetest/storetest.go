@@ -0,0 +1,227 @@
+// Package storetest provides an in-memory store.Store for handler and
+// authenticator tests.
+package storetest
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/models/store"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+// Memory keeps users, linked identities and second factors in maps. It
+// reports missing rows and duplicates with the same errors as
+// store.Storage. Methods it does not implement panic through the nil
+// embedded Store.
+type Memory struct {
+	store.Store
+
+	mu         sync.Mutex
+	users      map[int64]*types.User
+	identities map[string]int64 // issuer + " " + subject -> user ID
+	totp       map[int64]*types.TOTP
+	recovery   map[int64]map[string]bool // user ID -> code hash -> used
+	nextID     int64
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:      map[int64]*types.User{},
+		identities: map[string]int64{},
+		totp:       map[int64]*types.TOTP{},
+		recovery:   map[int64]map[string]bool{},
+	}
+}
+
+var errUserNotFound = apierror.NotFound("user_not_found", "User not found")
+
+// Users returns copies of the stored users, in creation order.
+func (m *Memory) Users() []types.User {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	users := make([]types.User, 0, len(m.users))
+	for id := int64(1); id <= m.nextID; id++ {
+		if u, ok := m.users[id]; ok {
+			users = append(users, *u)
+		}
+	}
+	return users
+}
+
+// Identity returns the ID of the user linked to the identity, or 0.
+func (m *Memory) Identity(issuer, subject string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.identities[issuer+" "+subject]
+}
+
+func (m *Memory) CreateUser(ctx context.Context, u *types.User) (*types.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, other := range m.users {
+		if strings.EqualFold(other.Email, u.Email) {
+			return nil, apierror.Conflict("email_taken", "A user with this email already exists")
+		}
+	}
+
+	m.nextID++
+	created := *u
+	created.ID = m.nextID
+	created.Version = 1
+	m.users[created.ID] = &created
+
+	out := created
+	return &out, nil
+}
+
+func (m *Memory) GetUserByID(ctx context.Context, id string) (*types.User, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, errUserNotFound
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.user(n)
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, u := range m.users {
+		if strings.EqualFold(u.Email, email) {
+			return m.user(id)
+		}
+	}
+	return nil, errUserNotFound
+}
+
+func (m *Memory) GetUserByIdentity(ctx context.Context, issuer, subject string) (*types.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, ok := m.identities[issuer+" "+subject]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	return m.user(id)
+}
+
+func (m *Memory) LinkIdentity(ctx context.Context, userID int64, issuer, subject string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := issuer + " " + subject
+	if _, ok := m.identities[key]; ok {
+		return apierror.Conflict("identity_linked", "This identity is already linked to a user")
+	}
+	m.identities[key] = userID
+	return nil
+}
+
+func (m *Memory) UpdatePassword(ctx context.Context, user *types.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[user.ID]
+	if !ok {
+		return errUserNotFound
+	}
+	u.Password = user.Password
+	return nil
+}
+
+func (m *Memory) UpdateUserRole(ctx context.Context, user *types.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.users[user.ID]
+	if !ok {
+		return errUserNotFound
+	}
+	if u.Version != user.Version {
+		return apierror.PreconditionFailed("User was changed by another request")
+	}
+	u.Role = user.Role
+	u.Version++
+	user.Version = u.Version
+	return nil
+}
+
+func (m *Memory) GetTOTP(ctx context.Context, userID int64) (*types.TOTP, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.totp[userID]
+	if !ok {
+		return nil, apierror.NotFound("two_factor_not_enrolled", "Two-factor authentication is not set up")
+	}
+	out := *t
+	return &out, nil
+}
+
+func (m *Memory) SaveTOTP(ctx context.Context, t *types.TOTP) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	saved := *t
+	m.totp[t.UserID] = &saved
+	return nil
+}
+
+// UpdateTOTPStep records step unless it is not after the last one used.
+func (m *Memory) UpdateTOTPStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.totp[userID]
+	if !ok || step <= t.LastUsedStep {
+		return false, nil
+	}
+	t.LastUsedStep = step
+	return true, nil
+}
+
+func (m *Memory) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	codes := map[string]bool{}
+	for _, h := range hashes {
+		codes[h] = false
+	}
+	m.recovery[userID] = codes
+	return nil
+}
+
+func (m *Memory) UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used, ok := m.recovery[userID][hash]
+	if !ok || used {
+		return false, nil
+	}
+	m.recovery[userID][hash] = true
+	return true, nil
+}
+
+// user returns a copy, so callers cannot change the stored user without
+// going through the store. m.mu must be held.
+func (m *Memory) user(id int64) (*types.User, error) {
+	u, ok := m.users[id]
+	if !ok {
+		return nil, errUserNotFound
+	}
+	out := *u
+	return &out, nil
+}
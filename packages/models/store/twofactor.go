@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+func (s *Storage) GetTOTP(ctx context.Context, userID int64) (*types.TOTP, error) {
+	var t types.TOTP
+	query := "SELECT userId, secret, confirmed, lastUsedStep, createdAt FROM user_totp WHERE userId = ?"
+	err := s.queryRow(ctx, query, userID).Scan(&t.UserID, &t.Secret, &t.Confirmed, &t.LastUsedStep, &t.CreatedAt)
+	return &t, notFound(err, "two_factor_not_enrolled", "Two-factor authentication is not set up")
+}
+
+// SaveTOTP stores a new, unconfirmed secret for the user, replacing any
+// pending enrollment.
+func (s *Storage) SaveTOTP(ctx context.Context, t *types.TOTP) error {
+	query := `INSERT INTO user_totp (userId, secret, confirmed, lastUsedStep) VALUES (?, ?, FALSE, 0)
+		ON DUPLICATE KEY UPDATE secret = VALUES(secret), confirmed = FALSE, lastUsedStep = 0`
+
+	_, err := s.exec(ctx, query, t.UserID, t.Secret)
+	return err
+}
+
+func (s *Storage) ConfirmTOTP(ctx context.Context, userID int64, step int64) error {
+	_, err := s.exec(ctx, "UPDATE user_totp SET confirmed = TRUE, lastUsedStep = ? WHERE userId = ?", step, userID)
+	return err
+}
+
+// UpdateTOTPStep records the time step of an accepted code. It reports false
+// when the step was already used, so a code cannot be replayed.
+func (s *Storage) UpdateTOTPStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	result, err := s.exec(ctx, "UPDATE user_totp SET lastUsedStep = ? WHERE userId = ? AND lastUsedStep < ?", step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
+
+func (s *Storage) DeleteTOTP(ctx context.Context, userID int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := s.execTx(ctx, tx, "DELETE FROM user_recovery_codes WHERE userId = ?", userID); err != nil {
+		return err
+	}
+	if _, err := s.execTx(ctx, tx, "DELETE FROM user_totp WHERE userId = ?", userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Storage) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := s.execTx(ctx, tx, "DELETE FROM user_recovery_codes WHERE userId = ?", userID); err != nil {
+		return err
+	}
+
+	for _, h := range hashes {
+		if _, err := s.execTx(ctx, tx, "INSERT INTO user_recovery_codes (userId, codeHash) VALUES (?, ?)", userID, h); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks a recovery code as used. It reports false when the
+// code does not exist or has already been used.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error) {
+	result, err := s.exec(ctx, "UPDATE user_recovery_codes SET usedAt = CURRENT_TIMESTAMP WHERE userId = ? AND codeHash = ? AND usedAt IS NULL", userID, hash)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n == 1, nil
+}
@@ -2,6 +2,21 @@ package types
 
 import "time"
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Task statuses, matching the tasks.status column.
+const (
+	TaskStatusTodo       = "TODO"
+	TaskStatusInProgress = "IN_PROGRESS"
+	TaskStatusInTesting  = "IN_TESTING"
+	TaskStatusDone       = "DONE"
+)
+
+var TaskStatuses = []string{TaskStatusTodo, TaskStatusInProgress, TaskStatusInTesting, TaskStatusDone}
+
 type RegisterPayload struct {
 	Email     string `json:"email"`
 	FirstName string `json:"firstName"`
@@ -11,23 +26,26 @@ type RegisterPayload struct {
 
 type User struct {
 	ID        int64     `json:"id"`
-	Email     string    `json:"email"`
-	FirstName string    `json:"firstName"`
-	LastName  string    `json:"lastName"`
-	Password  string    `json:"password"`
+	Email     string    `json:"email" validate:"required,email,max=255"`
+	FirstName string    `json:"firstName" validate:"required,max=255"`
+	LastName  string    `json:"lastName" validate:"required,max=255"`
+	Password  string    `json:"-" validate:"required"` // hash, never sent to clients
+	Role      string    `json:"role"`
+	Version   int64     `json:"version"`
 	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
 }
 
 type UserUpdateRequest struct {
 	ID        int64  `json:"id"`
-	Email     string `json:"email"`
-	FirstName string `json:"firstName"`
-	LastName  string `json:"lastName"`
+	Email     string `json:"email" validate:"omitempty,email,max=255"`
+	FirstName string `json:"firstName" validate:"omitempty,max=255"`
+	LastName  string `json:"lastName" validate:"omitempty,max=255"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 type LoginResponse struct {
@@ -35,9 +53,41 @@ type LoginResponse struct {
 	Token string `json:"token"`
 }
 
+type LoginChallengeResponse struct {
+	TwoFactorRequired bool   `json:"twoFactorRequired"`
+	Challenge         string `json:"challenge"`
+}
+
+type LoginTwoFactorRequest struct {
+	Challenge    string `json:"challenge" validate:"required"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+type TOTP struct {
+	UserID       int64     `json:"userId"`
+	Secret       string    `json:"-"`
+	Confirmed    bool      `json:"confirmed"`
+	LastUsedStep int64     `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
 type ChangePassword struct {
-	CurrentPassword string `json:"current_password"`
-	NewPassword     string `json:"new_password"`
+	CurrentPassword string `json:"current_password" validate:"required"`
+	NewPassword     string `json:"new_password" validate:"required"`
 }
 
 type CreateProjectPayload struct {
@@ -46,30 +96,81 @@ type CreateProjectPayload struct {
 
 type Project struct {
 	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
+	Name      string    `json:"name" validate:"required,max=255"`
+	Version   int64     `json:"version"`
 	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
 }
 
 type UpdateProject struct {
 	ID   int64  `json:"id"`
-	Name string `json:"name"`
+	Name string `json:"name" validate:"omitempty,max=255"`
 }
 
 type CreateTaskPayLoad struct {
 	Name         string `json:"name"`
-	ProjectID    int64  `json:"projectID"`
-	AssignedToID int64  `json:"assignedTo"`
+	Status       string `json:"status"`
+	ProjectID    int64  `json:"projectId"`
+	AssignedToID int64  `json:"assignedToID"`
 }
 
 type Task struct {
 	ID           int64     `json:"id"`
-	Name         string    `json:"name"`
-	Status       string    `json:"status"`
-	ProjectId    int64     `json:"projectId"`
-	AssignedToID int64     `json:"assignedToID"`
+	Name         string    `json:"name" validate:"required,max=255"`
+	Status       string    `json:"status" validate:"omitempty,taskstatus"`
+	ProjectId    int64     `json:"projectId" validate:"required,min=1,projectexists"`
+	AssignedToID int64     `json:"assignedToID" validate:"required,min=1,userexists"`
+	Version      int64     `json:"version"`
 	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// ProjectTaskRequest creates a task in the project named by the URL.
+type ProjectTaskRequest struct {
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	AssignedToID int64  `json:"assignedToID"`
+}
+
+// ListOptions selects one page of a list, ordered by Sort and then ID.
+// After continues from the last row of the previous page.
+type ListOptions struct {
+	Limit int
+	Sort  string
+	Desc  bool
+	After *Cursor
+}
+
+// Cursor marks the last row of a page by its sort value and ID. It also
+// records the order it was issued for, so it cannot be reused with another.
+type Cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value any    `json:"v"`
+	ID    int64  `json:"id"`
+}
+
+// Filters narrow a list. Zero values do not filter; Name and Email match
+// substrings.
+type UserFilter struct {
+	Name          string
+	Email         string
+	Role          string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+type ProjectFilter struct {
+	Name          string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+type TaskFilter struct {
+	Name          string
+	Status        string
+	ProjectID     int64
+	AssignedToID  int64
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
 }
@@ -0,0 +1,166 @@
+// Package pagination reads list parameters from the query string and links
+// clients to the next page.
+//
+//	GET /api/v2/projects?name=api&sort=-createdAt&limit=50
+//
+// limit is the page size, sort names the field to order by, with a leading
+// "-" for descending order, and cursor continues a previous listing. The
+// next page is announced in a Link header with rel="next".
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+	"github.com/AriJaya07/go-rest-api/packages/validation"
+)
+
+var errInvalidCursor = apierror.BadRequest("invalid_cursor", "Cursor is not valid")
+
+// Query reads typed parameters from a request's query string and collects
+// what is wrong with them, so a handler can report every problem at once.
+type Query struct {
+	values url.Values
+	errs   validation.Errors
+	err    error
+}
+
+func NewQuery(r *http.Request) *Query {
+	return &Query{values: r.URL.Query(), errs: validation.Errors{}}
+}
+
+func (q *Query) String(name string) string {
+	return strings.TrimSpace(q.values.Get(name))
+}
+
+// ID reads a positive integer, or 0 when the parameter is absent.
+func (q *Query) ID(name string) int64 {
+	s := q.String(name)
+	if s == "" {
+		return 0
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 1 {
+		q.errs.Add(name, "must be a positive integer")
+		return 0
+	}
+	return n
+}
+
+// Time reads an RFC 3339 timestamp or a YYYY-MM-DD date.
+func (q *Query) Time(name string) time.Time {
+	s := q.String(name)
+	if s == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	q.errs.Add(name, "must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	return time.Time{}
+}
+
+// OneOf reads a value that must be one of choices, or "" when absent.
+func (q *Query) OneOf(name string, choices []string) string {
+	s := q.String(name)
+	if s == "" {
+		return s
+	}
+
+	for _, c := range choices {
+		if s == c {
+			return s
+		}
+	}
+	q.errs.Add(name, "must be one of: "+strings.Join(choices, ", "))
+	return ""
+}
+
+// ListOptions reads limit, sort and cursor. Lists are sorted by id unless
+// asked otherwise; which other fields are allowed is up to the store.
+func (q *Query) ListOptions() types.ListOptions {
+	opts := types.ListOptions{Limit: config.Envs.PageSizeDefault, Sort: "id"}
+
+	if s := q.String("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > config.Envs.PageSizeMax {
+			q.errs.Add("limit", fmt.Sprintf("must be an integer from 1 to %d", config.Envs.PageSizeMax))
+		} else {
+			opts.Limit = n
+		}
+	}
+
+	if s := q.String("sort"); s != "" {
+		opts.Sort, opts.Desc = strings.TrimPrefix(s, "-"), strings.HasPrefix(s, "-")
+	}
+
+	if s := q.String("cursor"); s != "" {
+		cursor, err := DecodeCursor(s)
+		switch {
+		case err != nil:
+			q.err = errInvalidCursor
+		case cursor.Sort != opts.Sort || cursor.Desc != opts.Desc:
+			q.err = apierror.BadRequest("invalid_cursor", "Cursor was issued for a different sort order")
+		default:
+			opts.After = cursor
+		}
+	}
+
+	return opts
+}
+
+// Err returns a 400 for an unusable cursor, a 422 listing every invalid
+// parameter, or nil.
+func (q *Query) Err() error {
+	if q.err != nil {
+		return q.err
+	}
+	return q.errs.Err()
+}
+
+// EncodeCursor makes an opaque, URL-safe token of c.
+func EncodeCursor(c *types.Cursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func DecodeCursor(s string) (*types.Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c types.Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if c.Sort == "" {
+		return nil, fmt.Errorf("cursor has no sort field")
+	}
+	return &c, nil
+}
+
+// SetNext links to the page after the one being served, keeping the
+// request's other parameters. It does nothing on the last page.
+func SetNext(w http.ResponseWriter, r *http.Request, next *types.Cursor) {
+	if next == nil {
+		return
+	}
+
+	query := r.URL.Query()
+	query.Set("cursor", EncodeCursor(next))
+	w.Header().Add("Link", "<"+r.URL.Path+"?"+query.Encode()+`>; rel="next"`)
+}
@@ -0,0 +1,119 @@
+package pagination
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/models/types"
+)
+
+func TestListOptions(t *testing.T) {
+	cursor := EncodeCursor(&types.Cursor{Sort: "name", Desc: true, Value: "b", ID: 7})
+
+	tests := []struct {
+		name   string
+		query  string
+		want   types.ListOptions
+		status int
+		code   string
+		fields map[string][]string
+	}{
+		{name: "defaults", want: types.ListOptions{Limit: config.Envs.PageSizeDefault, Sort: "id"}},
+		{name: "limit and sort", query: "limit=5&sort=-createdAt", want: types.ListOptions{Limit: 5, Sort: "createdAt", Desc: true}},
+		{name: "cursor", query: "sort=-name&cursor=" + cursor,
+			want: types.ListOptions{Limit: config.Envs.PageSizeDefault, Sort: "name", Desc: true,
+				After: &types.Cursor{Sort: "name", Desc: true, Value: "b", ID: 7}}},
+		{name: "limit too small", query: "limit=0", status: http.StatusUnprocessableEntity, code: apierror.CodeValidation,
+			fields: map[string][]string{"limit": {"must be an integer from 1 to 100"}}},
+		{name: "limit too large", query: "limit=101", status: http.StatusUnprocessableEntity, code: apierror.CodeValidation},
+		{name: "limit not a number", query: "limit=ten", status: http.StatusUnprocessableEntity, code: apierror.CodeValidation},
+		{name: "garbled cursor", query: "cursor=%21%21", status: http.StatusBadRequest, code: "invalid_cursor"},
+		{name: "cursor for another sort", query: "sort=name&cursor=" + cursor, status: http.StatusBadRequest, code: "invalid_cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQuery(httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil))
+			opts := q.ListOptions()
+			err := q.Err()
+
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if !reflect.DeepEqual(opts, tt.want) {
+					t.Errorf("got %+v, want %+v", opts, tt.want)
+				}
+				return
+			}
+
+			e := apierror.From(err)
+			if e.Status() != tt.status || e.Code != tt.code {
+				t.Fatalf("got %d %q (%s), want %d %q", e.Status(), e.Code, e.Detail, tt.status, tt.code)
+			}
+			if tt.fields != nil && !reflect.DeepEqual(e.Fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", e.Fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestQueryFilters(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/?projectId=x&createdAfter=2024-01-02&createdBefore=yesterday&status=done&role=admin", nil)
+	q := NewQuery(r)
+
+	q.ID("projectId")
+	if got := q.Time("createdAfter"); got.Format("2006-01-02") != "2024-01-02" {
+		t.Errorf("createdAfter = %v", got)
+	}
+	q.Time("createdBefore")
+	q.OneOf("status", types.TaskStatuses)
+	if got := q.OneOf("role", []string{types.RoleUser, types.RoleAdmin}); got != types.RoleAdmin {
+		t.Errorf("role = %q", got)
+	}
+
+	e := apierror.From(q.Err())
+	if len(e.Fields) != 3 || e.Fields["projectId"] == nil || e.Fields["createdBefore"] == nil || e.Fields["status"] == nil {
+		t.Errorf("fields = %v, want projectId, createdBefore and status", e.Fields)
+	}
+}
+
+func TestSetNext(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/v2/projects?name=api&limit=2&cursor=old", nil)
+
+	w := httptest.NewRecorder()
+	SetNext(w, r, nil)
+	if link := w.Header().Get("Link"); link != "" {
+		t.Fatalf("last page got Link %q", link)
+	}
+
+	next := &types.Cursor{Sort: "id", Value: float64(4), ID: 4}
+	SetNext(w, r, next)
+
+	link := w.Header().Get("Link")
+	target, ok := strings.CutSuffix(link, `>; rel="next"`)
+	if !ok || !strings.HasPrefix(target, "<") {
+		t.Fatalf("Link = %q", link)
+	}
+	u, err := url.Parse(target[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/api/v2/projects" || u.Query().Get("name") != "api" || u.Query().Get("limit") != "2" {
+		t.Errorf("next page %q lost the request's parameters", u)
+	}
+
+	got, err := DecodeCursor(u.Query().Get("cursor"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, next) {
+		t.Errorf("cursor = %+v, want %+v", got, next)
+	}
+}
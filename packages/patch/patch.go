@@ -0,0 +1,369 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON representations of resources.
+//
+// Errors are *apierror.Error: a malformed patch is a 400 with code
+// invalid_patch, and one that does not fit the document, such as removing a
+// member that is not there or a failed test operation, is a 409.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+)
+
+// Media types of the two patch formats.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// Operation is one step of a JSON Patch.
+type Operation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from,omitempty"`
+	// Value is nil when the operation has no value member, and the JSON
+	// literal null when it is explicitly null.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Merge applies the merge patch p to doc: members of p replace those of doc,
+// objects are merged recursively and null removes a member.
+func Merge(doc, p []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := decode(p)
+	if err != nil {
+		return nil, invalid("Merge patch is not valid JSON")
+	}
+
+	return json.Marshal(merge(target, patch))
+}
+
+func merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+		} else {
+			t[name] = merge(t[name], value)
+		}
+	}
+	return t
+}
+
+// Apply runs ops against doc in order. Either every operation succeeds or
+// the error of the first that fails is returned.
+func Apply(doc []byte, ops []Operation) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		if target, err = op.apply(target); err != nil {
+			if e, ok := err.(*apierror.Error); ok {
+				e.Detail = fmt.Sprintf("Operation %d (%s %s): %s", i, op.Op, op.Path, e.Detail)
+			}
+			return nil, err
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func (op Operation) apply(doc any) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, invalid("value is required")
+		}
+		value, err := decode(op.Value)
+		if err != nil {
+			return nil, invalid("value is not valid JSON")
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		}
+		current, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(current, value) {
+			return nil, apierror.Conflict("patch_test_failed", "value does not match")
+		}
+		return doc, nil
+
+	case "remove":
+		return remove(doc, path)
+
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			// the copy must not share maps or slices with the original
+			b, _ := json.Marshal(value)
+			value, _ = decode(b)
+			return add(doc, path, value)
+		}
+
+		if op.Path != op.From && strings.HasPrefix(op.Path+"/", op.From+"/") {
+			return nil, invalid("a value cannot be moved into itself")
+		}
+		if doc, err = remove(doc, from); err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	}
+
+	return nil, invalid(fmt.Sprintf("op must be one of add, remove, replace, move, copy or test, not %q", op.Op))
+}
+
+// pointerEscaper undoes the RFC 6901 escapes; ~1 must go first so "~01"
+// becomes "~1" rather than "/".
+var pointerEscaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// parsePointer splits a JSON Pointer into its reference tokens. The empty
+// pointer is the whole document.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, invalid(fmt.Sprintf("path %q must be empty or start with /", p))
+	}
+
+	tokens := strings.Split(p[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = pointerEscaper.Replace(token)
+	}
+	return tokens, nil
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, missing(token)
+			}
+			doc = value
+		case []any:
+			i, err := index(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, missing(token)
+		}
+	}
+	return doc, nil
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	return update(doc, path, value, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			if token == "-" {
+				return append(node, value), nil
+			}
+			// one past the end appends
+			i, err := index(token, len(node)+1)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:i], append([]any{value}, node[i:]...)...), nil
+		}
+		return nil, missing(token)
+	})
+}
+
+func remove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, invalid("the whole document cannot be removed")
+	}
+
+	return update(doc, path, nil, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			if _, ok := node[token]; !ok {
+				return nil, missing(token)
+			}
+			delete(node, token)
+			return node, nil
+		case []any:
+			i, err := index(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, missing(token)
+	})
+}
+
+func replace(doc any, path []string, value any) (any, error) {
+	return update(doc, path, value, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			if _, ok := node[token]; !ok {
+				return nil, missing(token)
+			}
+			node[token] = value
+			return node, nil
+		case []any:
+			i, err := index(token, len(node))
+			if err != nil {
+				return nil, err
+			}
+			node[i] = value
+			return node, nil
+		}
+		return nil, missing(token)
+	})
+}
+
+// update walks to the parent of the last token in path and replaces it
+// with what change returns. Arrays may be reallocated, so every level is
+// stored back into its own parent. An empty path replaces doc with value.
+func update(doc any, path []string, value any, change func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	if len(path) == 1 {
+		return change(doc, path[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, missing(path[0])
+		}
+		child, err := update(child, path[1:], value, change)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = child
+		return node, nil
+	case []any:
+		i, err := index(path[0], len(node))
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(node[i], path[1:], value, change)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	}
+
+	return nil, missing(path[0])
+}
+
+// index parses an array index, which must be below n.
+func index(token string, n int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, invalid(fmt.Sprintf("%q is not an array index", token))
+	}
+	if i >= n {
+		return 0, apierror.Conflict("patch_conflict", fmt.Sprintf("index %d is out of range", i))
+	}
+	return i, nil
+}
+
+// equal compares decoded JSON values, treating numbers by value.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for name, value := range a {
+			other, ok := b[name]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// decode keeps numbers as written, so large IDs survive the round trip.
+func decode(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func invalid(detail string) error {
+	return apierror.BadRequest("invalid_patch", detail)
+}
+
+func missing(token string) error {
+	return apierror.Conflict("patch_conflict", fmt.Sprintf("%q does not exist", token))
+}
@@ -0,0 +1,115 @@
+package patch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+)
+
+// sameJSON compares documents regardless of member order.
+func sameJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("result %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("want %s: %v", want, err)
+	}
+	a, _ := json.Marshal(g)
+	b, _ := json.Marshal(w)
+	if string(a) != string(b) {
+		t.Errorf("got %s, want %s", a, b)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	// from RFC 7396, appendix A
+	tests := []struct{ doc, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		// numbers keep their precision
+		{`{"id":9007199254740993}`, `{"n":1}`, `{"id":9007199254740993,"n":1}`},
+	}
+
+	for _, tt := range tests {
+		got, err := Merge([]byte(tt.doc), []byte(tt.patch))
+		if err != nil {
+			t.Errorf("%s + %s: %v", tt.doc, tt.patch, err)
+			continue
+		}
+		sameJSON(t, got, tt.want)
+	}
+
+	if got, _ := Merge([]byte(`{"id":9007199254740993}`), []byte(`{}`)); string(got) != `{"id":9007199254740993}` {
+		t.Errorf("large number became %s", got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	// mostly from RFC 6902, appendix A
+	tests := []struct {
+		name string
+		doc  string
+		ops  string
+		want string
+		code string
+	}{
+		{name: "add member", doc: `{"foo":"bar"}`, ops: `[{"op":"add","path":"/baz","value":"qux"}]`, want: `{"baz":"qux","foo":"bar"}`},
+		{name: "add to array", doc: `{"foo":["bar","baz"]}`, ops: `[{"op":"add","path":"/foo/1","value":"qux"}]`, want: `{"foo":["bar","qux","baz"]}`},
+		{name: "append to array", doc: `{"foo":["bar"]}`, ops: `[{"op":"add","path":"/foo/-","value":["abc"]}]`, want: `{"foo":["bar",["abc"]]}`},
+		{name: "add null", doc: `{}`, ops: `[{"op":"add","path":"/foo","value":null}]`, want: `{"foo":null}`},
+		{name: "remove member", doc: `{"baz":"qux","foo":"bar"}`, ops: `[{"op":"remove","path":"/baz"}]`, want: `{"foo":"bar"}`},
+		{name: "remove element", doc: `{"foo":["bar","qux","baz"]}`, ops: `[{"op":"remove","path":"/foo/1"}]`, want: `{"foo":["bar","baz"]}`},
+		{name: "replace", doc: `{"baz":"qux","foo":"bar"}`, ops: `[{"op":"replace","path":"/baz","value":"boo"}]`, want: `{"baz":"boo","foo":"bar"}`},
+		{name: "move member", doc: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			ops:  `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			want: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{name: "move element", doc: `{"foo":["all","grass","cows","eat"]}`, ops: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, want: `{"foo":["all","cows","eat","grass"]}`},
+		{name: "copy", doc: `{"a":{"b":1}}`, ops: `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, want: `{"a":{"b":1},"c":{"b":2}}`},
+		{name: "test passes", doc: `{"baz":"qux","foo":["a",2,"c"]}`, ops: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, want: `{"baz":"qux","foo":["a",2,"c"]}`},
+		{name: "escaped path", doc: `{"a/b":1,"m~n":2}`, ops: `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`, want: `{"a/b":3}`},
+		{name: "whole document", doc: `{"a":1}`, ops: `[{"op":"replace","path":"","value":{"b":2}}]`, want: `{"b":2}`},
+
+		{name: "test fails", doc: `{"baz":"qux"}`, ops: `[{"op":"test","path":"/baz","value":"bar"}]`, code: "patch_test_failed"},
+		{name: "missing member", doc: `{"foo":"bar"}`, ops: `[{"op":"add","path":"/baz/bat","value":"qux"}]`, code: "patch_conflict"},
+		{name: "remove missing", doc: `{}`, ops: `[{"op":"remove","path":"/a"}]`, code: "patch_conflict"},
+		{name: "replace missing", doc: `{}`, ops: `[{"op":"replace","path":"/a","value":1}]`, code: "patch_conflict"},
+		{name: "index out of range", doc: `{"foo":["bar"]}`, ops: `[{"op":"add","path":"/foo/2","value":"x"}]`, code: "patch_conflict"},
+		{name: "unknown op", doc: `{}`, ops: `[{"op":"frob","path":"/a"}]`, code: "invalid_patch"},
+		{name: "missing value", doc: `{}`, ops: `[{"op":"add","path":"/a"}]`, code: "invalid_patch"},
+		{name: "relative path", doc: `{}`, ops: `[{"op":"add","path":"a","value":1}]`, code: "invalid_patch"},
+		{name: "bad index", doc: `{"foo":["bar"]}`, ops: `[{"op":"replace","path":"/foo/01","value":"x"}]`, code: "invalid_patch"},
+		{name: "move into itself", doc: `{"a":{"b":{}}}`, ops: `[{"op":"move","from":"/a","path":"/a/b/c"}]`, code: "invalid_patch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []Operation
+			if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Apply([]byte(tt.doc), ops)
+			if tt.code != "" {
+				if e := apierror.From(err); e.Code != tt.code {
+					t.Fatalf("got %v, want code %s", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			sameJSON(t, got, tt.want)
+		})
+	}
+}
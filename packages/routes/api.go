@@ -1,41 +1,242 @@
 package api
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/AriJaya07/go-rest-api/packages/controllers/projects"
-	"github.com/AriJaya07/go-rest-api/packages/controllers/tasks"
-	"github.com/AriJaya07/go-rest-api/packages/controllers/users"
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/auth"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/docs"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/health"
+	"github.com/AriJaya07/go-rest-api/packages/metrics"
+	"github.com/AriJaya07/go-rest-api/packages/middleware"
 	"github.com/AriJaya07/go-rest-api/packages/models/store"
 	"github.com/gorilla/mux"
 )
 
 type APIServer struct {
-	addr  string
-	store store.Store
+	addr     string
+	store    store.Store
+	health   *health.HealthService
+	versions []apiVersion
 }
 
-func NewAPIServer(addr string, store store.Store) *APIServer {
-	return &APIServer{
-		addr:  addr,
-		store: store,
+func NewAPIServer(addr string, store store.Store, schemaVersion int) *APIServer {
+	s := &APIServer{
+		addr:   addr,
+		store:  store,
+		health: health.NewHealthService(store, schemaVersion),
 	}
+	s.versions = s.apiVersions()
+
+	return s
 }
 
-func (s *APIServer) Serve() {
+// Router builds the route tree without the server-wide middleware stack.
+func (s *APIServer) Router() (*mux.Router, error) {
 	router := mux.NewRouter()
-	subrouter := router.PathPrefix("/api/v1").Subrouter()
+	// on the root router, so top-level routes are labelled too
+	router.Use(middleware.RouteTemplate)
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	s.health.RegisterRoutes(router)
 
-	projectService := projects.NewProjectService(s.store)
-	projectService.RegisterRoutes(subrouter)
+	docsService := docs.NewDocsService()
+	docsService.RegisterRoutes(router)
+
+	// one limiter, so clients have the same budget whichever version they
+	// call
+	var limiter *middleware.RateLimiter
+	if config.Envs.RateLimitEnabled {
+		var err error
+		if limiter, err = newRateLimiter(s.versions); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, version := range s.versions {
+		subrouter := router.PathPrefix(version.prefix()).Subrouter()
+		if limiter != nil {
+			subrouter.Use(limiter.Middleware)
+		}
+		if len(version.successors) > 0 {
+			subrouter.Use(middleware.Deprecated(version.deprecations()))
+		}
+
+		version.register(subrouter)
+	}
+
+	return router, nil
+}
+
+// Serve runs the server until it receives SIGINT or SIGTERM, then stops
+// accepting connections, waits for in-flight requests to finish and closes
+// the store.
+func (s *APIServer) Serve() error {
+	if err := auth.ValidatePasswordHasher(); err != nil {
+		return err
+	}
+
+	router, err := s.Router()
+	if err != nil {
+		return err
+	}
+
+	stack, err := s.middlewares()
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		s.store.Close()
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// a second signal kills the process as usual
+	context.AfterFunc(ctx, stop)
+
+	return s.serve(ctx, ln, middleware.Chain(router, stack...))
+}
+
+// serve runs handler on ln until ctx is done, then shuts down as Serve
+// describes.
+func (s *APIServer) serve(ctx context.Context, ln net.Listener, handler http.Handler) error {
+	server := &http.Server{
+		Handler:           handler,
+		ReadTimeout:       config.Envs.ReadTimeout,
+		ReadHeaderTimeout: config.Envs.ReadHeaderTimeout,
+		WriteTimeout:      config.Envs.WriteTimeout,
+		IdleTimeout:       config.Envs.IdleTimeout,
+		MaxHeaderBytes:    config.Envs.MaxHeaderBytes,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("starting the API server", slog.String("addr", ln.Addr().String()))
+		serveErr <- server.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		s.store.Close()
+		return err
+	case <-ctx.Done():
+	}
 
-	usersService := users.NewUserService(s.store)
-	usersService.RegisterRoutes(subrouter)
+	slog.Info("shutting down the API server")
 
-	tasksService := tasks.NewTasksService(s.store)
-	tasksService.RegisterRoutes(subrouter)
+	// fail readiness first and give load balancers time to notice before
+	// we stop accepting connections
+	s.health.SetShuttingDown()
+	time.Sleep(config.Envs.ShutdownDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.Envs.ShutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(shutdownCtx)
+	if closeErr := s.store.Close(); err == nil {
+		err = closeErr
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	return err
+}
+
+// middlewares returns the stack wrapped around every request, outermost
+// first.
+func (s *APIServer) middlewares() ([]middleware.Middleware, error) {
+	stack := []middleware.Middleware{
+		middleware.RequestID,
+		middleware.Tracing,
+		middleware.AccessLog,
+		middleware.Metrics,
+		middleware.Recover,
+		middleware.SecurityHeaders(config.Envs.HSTSMaxAge),
+		middleware.CORS(middleware.CORSConfig{
+			AllowedOrigins: config.Envs.CORSAllowedOrigins,
+			AllowedMethods: config.Envs.CORSAllowedMethods,
+			AllowedHeaders: config.Envs.CORSAllowedHeaders,
+			ExposedHeaders: []string{
+				middleware.RequestIDHeader,
+				"RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After",
+				middleware.APIVersionHeader, "Deprecation", "Sunset", "Link",
+				"ETag",
+			},
+			AllowCredentials: config.Envs.CORSAllowCredentials,
+			MaxAge:           config.Envs.CORSMaxAge,
+		}),
+	}
+
+	versions := make([]string, len(s.versions))
+	for i, version := range s.versions {
+		versions[i] = version.name
+	}
+	negotiate, err := middleware.APIVersion(middleware.VersionConfig{
+		Prefix:    apiPrefix,
+		Versions:  versions,
+		Default:   config.Envs.APIDefaultVersion,
+		MediaType: apiMediaType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	stack = append(stack, negotiate)
+
+	if config.Envs.CompressionEnabled {
+		stack = append(stack, middleware.Compress(config.Envs.CompressionMinSize))
+	}
+
+	// innermost, so response validation sees the uncompressed body
+	if config.Envs.OpenAPIValidateRequests {
+		validate, err := middleware.OpenAPIValidation(middleware.OpenAPIConfig{
+			Spec:              docs.Spec,
+			MaxBodyBytes:      config.Envs.MaxBodyBytes,
+			ValidateResponses: config.Envs.OpenAPIValidateResponses,
+		})
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, validate)
+	}
+
+	return stack, nil
+}
+
+// newRateLimiter limits clients by user when they present a valid token and
+// by IP otherwise, with a stricter budget for the credential endpoints.
+func newRateLimiter(versions []apiVersion) (*middleware.RateLimiter, error) {
+	defaultRate, err := middleware.ParseRate(config.Envs.RateLimitDefault)
+	if err != nil {
+		return nil, err
+	}
+	authRate, err := middleware.ParseRate(config.Envs.RateLimitAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	ips := middleware.NewIPResolver(config.Envs.TrustedProxies)
+	key := func(r *http.Request) string {
+		if id, ok := auth.TokenUserID(r); ok {
+			return "user:" + id
+		}
+		return "ip:" + ips.ClientIP(r)
+	}
+
+	limiter := middleware.NewRateLimiter(middleware.NewMemoryLimiterStore(), defaultRate, key)
+	for _, v := range versions {
+		limiter.AddGroup("auth", authRate, v.credentialRoutes()...)
+	}
 
-	log.Println("Starting the API server at", s.addr)
-	log.Fatal(http.ListenAndServe(s.addr, subrouter))
+	return limiter, nil
 }
@@ -0,0 +1,593 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/docs"
+	"github.com/AriJaya07/go-rest-api/packages/middleware"
+	"github.com/AriJaya07/go-rest-api/packages/models/store"
+	"github.com/gorilla/mux"
+)
+
+// undocumented lists routes that are deliberately left out of the spec.
+var undocumented = map[string]bool{
+	"GET /docs/": true, // static assets for the docs UI
+}
+
+// TestOpenAPISpecMatchesRouter fails when a route is added or removed without
+// updating packages/controllers/docs/openapi.json, or the other way round.
+func TestOpenAPISpecMatchesRouter(t *testing.T) {
+	config.Envs.OIDCIssuer = "https://issuer.example.com"
+	config.Envs.RateLimitEnabled = false
+
+	router, err := NewAPIServer(":0", nil, 0).Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := map[string]bool{}
+	err = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// subrouter prefixes have no methods of their own
+			return nil
+		}
+		for _, m := range methods {
+			key := m + " " + path
+			if !undocumented[key] {
+				routes[key] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(docs.Spec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+
+	documented := map[string]bool{}
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	for _, key := range sortedKeys(routes) {
+		if !documented[key] {
+			t.Errorf("route %s is not documented in openapi.json", key)
+		}
+	}
+	for _, key := range sortedKeys(documented) {
+		if !routes[key] {
+			t.Errorf("openapi.json documents %s but no such route is registered", key)
+		}
+	}
+}
+
+// newValidatedHandler serves the router without a store, so only requests
+// that are rejected by validation or need no database can be exercised.
+func newValidatedHandler(t *testing.T) http.Handler {
+	t.Helper()
+
+	router, err := NewAPIServer(":0", nil, 0).Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validate, err := middleware.OpenAPIValidation(middleware.OpenAPIConfig{
+		Spec:              docs.Spec,
+		MaxBodyBytes:      1024,
+		ValidateResponses: true,
+		OnResponseError: func(r *http.Request, err error) {
+			t.Errorf("invalid response: %v", err)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return validate(router)
+}
+
+func TestOpenAPIValidationRejectsInvalidRequests(t *testing.T) {
+	config.Envs.RateLimitEnabled = false
+	handler := newValidatedHandler(t)
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		token       string
+		status      int
+		code        string
+		fields      []string
+	}{
+		{
+			name:        "missing and mistyped fields",
+			path:        "/api/v1/users/register",
+			contentType: "application/json",
+			body:        `{"email": 5}`,
+			status:      http.StatusUnprocessableEntity,
+			code:        apierror.CodeValidation,
+			fields:      []string{"email", "firstName", "lastName", "password"},
+		},
+		{
+			name:        "role cannot be chosen at registration",
+			path:        "/api/v2/users",
+			contentType: "application/json",
+			body:        `{"email": "a@example.com", "firstName": "A", "lastName": "B", "password": "Correct-horse-9", "role": "admin"}`,
+			status:      http.StatusUnprocessableEntity,
+			code:        apierror.CodeValidation,
+		},
+		{
+			name:        "malformed JSON",
+			path:        "/api/v1/users/login",
+			contentType: "application/json",
+			body:        `{"email":`,
+			status:      http.StatusBadRequest,
+			code:        "invalid_json",
+		},
+		{
+			name:   "missing content type",
+			path:   "/api/v1/users/login",
+			body:   `{"email": "a@example.com", "password": "secret"}`,
+			status: http.StatusUnsupportedMediaType,
+			code:   apierror.CodeUnsupportedMediaType,
+		},
+		{
+			name:        "body too large",
+			path:        "/api/v1/users/login",
+			contentType: "application/json",
+			body:        `{"email": "` + strings.Repeat("a", 2048) + `@example.com"}`,
+			status:      http.StatusRequestEntityTooLarge,
+			code:        apierror.CodePayloadTooLarge,
+		},
+		{
+			name:        "bad TOTP code",
+			path:        "/api/v1/users/2fa/confirm",
+			contentType: "application/json",
+			body:        `{"code": "12ab"}`,
+			token:       "not-a-token",
+			status:      http.StatusUnprocessableEntity,
+			code:        apierror.CodeValidation,
+			fields:      []string{"code"},
+		},
+		{
+			name:        "anonymous callers are not told what is invalid",
+			path:        "/api/v1/users/2fa/confirm",
+			contentType: "application/json",
+			body:        `{"code": "12ab"}`,
+			status:      http.StatusUnauthorized,
+			code:        apierror.CodeUnauthorized,
+		},
+		{
+			name:        "read-only fields",
+			path:        "/api/v2/projects",
+			contentType: "application/json",
+			body:        `{"id": 7, "name": "p", "version": 3}`,
+			token:       "not-a-token",
+			status:      http.StatusUnprocessableEntity,
+			code:        apierror.CodeValidation,
+			fields:      []string{"body"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != apierror.ContentType {
+				t.Errorf("Content-Type = %q, want %q", ct, apierror.ContentType)
+			}
+
+			var resp apierror.Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Code != tt.code {
+				t.Errorf("code = %q, want %q", resp.Code, tt.code)
+			}
+			for _, f := range tt.fields {
+				if len(resp.Fields[f]) == 0 {
+					t.Errorf("no error for field %q in %v", f, resp.Fields)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAPIValidationChecksResponses(t *testing.T) {
+	config.Envs.RateLimitEnabled = false
+	handler := newValidatedHandler(t)
+
+	tests := map[string]int{
+		"/healthz":                     http.StatusOK,
+		"/openapi.json":                http.StatusOK,
+		"/docs":                        http.StatusOK,
+		"/api/v1/projects":             http.StatusUnauthorized,
+		"/api/v2/projects":             http.StatusUnauthorized,
+		"/api/v2/projects?limit=0":     http.StatusUnprocessableEntity,
+		"/api/v2/tasks?sort=-priority": http.StatusUnprocessableEntity,
+		"/api/v2/users/1":              http.StatusUnauthorized,
+	}
+
+	for path, status := range tests {
+		// with credentials, so the query is checked before the handler
+		// rejects the token
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "not-a-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != status {
+			t.Errorf("GET %s: status = %d, want %d", path, rec.Code, status)
+		}
+	}
+}
+
+func TestOpenAPIValidationAcceptsPatchTypes(t *testing.T) {
+	config.Envs.RateLimitEnabled = false
+	handler := newValidatedHandler(t)
+
+	tests := []struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		// valid patches reach the handler, which rejects the token
+		{"application/merge-patch+json", `{"name":"new"}`, http.StatusUnauthorized},
+		{"application/json-patch+json", `[{"op":"replace","path":"/name","value":"new"}]`, http.StatusUnauthorized},
+		{"application/json-patch+json", `[{"op":"replace","path":"/name","value":"new","comment":"rename"}]`, http.StatusUnauthorized},
+		{"application/json-patch+json", `[{"op":"frob","path":"/name"}]`, http.StatusUnprocessableEntity},
+		{"text/plain", `name=new`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v2/projects/1", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		req.Header.Set("Authorization", "not-a-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.status {
+			t.Errorf("%s %s: status = %d, want %d: %s", tt.contentType, tt.body, rec.Code, tt.status, rec.Body)
+		}
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// TestDeprecatedRoutesMatchSpec keeps the deprecated flags in openapi.json
+// in step with the routes that send Deprecation headers.
+func TestDeprecatedRoutesMatchSpec(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]struct {
+			Deprecated bool `json:"deprecated"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(docs.Spec, &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	documented := map[string]bool{}
+	for path, ops := range spec.Paths {
+		for method, op := range ops {
+			if op.Deprecated {
+				documented[strings.ToUpper(method)+" "+path] = true
+			}
+		}
+	}
+
+	deprecated := map[string]bool{}
+	for _, version := range NewAPIServer(":0", nil, 0).versions {
+		for route := range version.deprecations() {
+			deprecated[route] = true
+		}
+	}
+
+	for _, key := range sortedKeys(deprecated) {
+		if !documented[key] {
+			t.Errorf("%s is deprecated but not marked so in openapi.json", key)
+		}
+	}
+	for _, key := range sortedKeys(documented) {
+		if !deprecated[key] {
+			t.Errorf("openapi.json marks %s deprecated but it sends no Deprecation header", key)
+		}
+	}
+}
+
+func TestAPIVersionNegotiation(t *testing.T) {
+	config.Envs.RateLimitEnabled = false
+	server := NewAPIServer(":0", nil, 0)
+
+	router, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack, err := server.middlewares()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := middleware.Chain(router, stack...)
+
+	tests := []struct {
+		name       string
+		path       string
+		accept     string
+		status     int
+		version    string
+		deprecated bool
+		link       string
+	}{
+		{name: "default version", path: "/api/projects", status: http.StatusUnauthorized, version: "v2"},
+		{name: "vendor media type", path: "/api/projects", accept: "application/vnd.go-rest-api.v1+json", status: http.StatusUnauthorized, version: "v1", deprecated: true, link: `</api/v2/projects>; rel="successor-version"`},
+		{name: "version parameter", path: "/api/projects/7", accept: "text/html, application/json; version=2", status: http.StatusUnauthorized, version: "v2"},
+		{name: "path wins over accept", path: "/api/v2/projects", accept: "application/json; version=1", status: http.StatusUnauthorized, version: "v2"},
+		{name: "deprecated path", path: "/api/v1/projects/detail/7", status: http.StatusUnauthorized, version: "v1", deprecated: true, link: `</api/v2/projects/7>; rel="successor-version"`},
+		{name: "deprecated without successor", path: "/api/v1/tasks/$7", status: http.StatusUnauthorized, version: "v1", deprecated: true},
+		{name: "unknown version", path: "/api/projects", accept: "application/vnd.go-rest-api.v9+json", status: http.StatusNotAcceptable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if got := rec.Header().Get(middleware.APIVersionHeader); got != tt.version {
+				t.Errorf("API-Version = %q, want %q", got, tt.version)
+			}
+			if got := rec.Header().Get("Deprecation") != ""; got != tt.deprecated {
+				t.Errorf("Deprecation = %q, want deprecated %v", rec.Header().Get("Deprecation"), tt.deprecated)
+			}
+			if got := rec.Header().Get("Link"); got != tt.link {
+				t.Errorf("Link = %q, want %q", got, tt.link)
+			}
+		})
+	}
+}
+
+// TestCredentialRoutesRateLimit checks that every route that takes a
+// password, in either version and unversioned, gets the auth limit.
+func TestCredentialRoutesRateLimit(t *testing.T) {
+	config.Envs.RateLimitEnabled = true
+	config.Envs.RateLimitDefault = "100/1m"
+	config.Envs.RateLimitAuth = "10/1m"
+	// invalid bodies would be rejected before they reach the limiter
+	validate := config.Envs.OpenAPIValidateRequests
+	config.Envs.OpenAPIValidateRequests = false
+	defer func() {
+		config.Envs.RateLimitEnabled = false
+		config.Envs.OpenAPIValidateRequests = validate
+	}()
+	server := NewAPIServer(":0", nil, 0)
+
+	router, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack, err := server.middlewares()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := middleware.Chain(router, stack...)
+
+	tests := []struct {
+		method string
+		path   string
+		accept string
+		limit  string
+	}{
+		{http.MethodPost, "/api/v1/users/login", "", "10"},
+		{http.MethodPost, "/api/v1/users/register", "", "10"},
+		{http.MethodPost, "/api/v2/users", "", "10"},
+		{http.MethodPost, "/api/users", "", "10"},
+		{http.MethodPost, "/api/users/register", "application/vnd.go-rest-api.v1+json", "10"},
+		{http.MethodGet, "/api/v2/users", "", "100"},
+		{http.MethodGet, "/api/v2/projects", "", "100"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if got := rec.Header().Get("RateLimit-Limit"); got != tt.limit {
+			t.Errorf("%s %s: RateLimit-Limit = %q, want %q (status %d)", tt.method, tt.path, got, tt.limit, rec.Code)
+		}
+	}
+}
+
+func TestMetricsRouteLabels(t *testing.T) {
+	// the versioned route would otherwise be rejected for its missing token
+	// before reaching the router
+	validate := config.Envs.OpenAPIValidateRequests
+	config.Envs.OpenAPIValidateRequests = false
+	defer func() { config.Envs.OpenAPIValidateRequests = validate }()
+	server := NewAPIServer(":0", nil, 0)
+
+	router, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stack, err := server.middlewares()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := middleware.Chain(router, stack...)
+
+	tests := []struct {
+		path   string
+		route  string
+		status int
+	}{
+		{"/healthz", "/healthz", http.StatusOK},
+		{"/metrics", "/metrics", http.StatusOK},
+		{"/openapi.json", "/openapi.json", http.StatusOK},
+		{"/docs", "/docs", http.StatusOK},
+		{"/api/v1/projects/detail/7", "/api/v1/projects/detail/{id}", http.StatusUnauthorized},
+		{"/no-such-route", "unmatched", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if rec.Code != tt.status {
+			t.Fatalf("GET %s: status = %d, want %d", tt.path, rec.Code, tt.status)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, tt := range tests {
+		series := fmt.Sprintf(`http_requests_total{method="GET",route=%q,status="%d"}`, tt.route, tt.status)
+		if !strings.Contains(rec.Body.String(), series) {
+			t.Errorf("GET %s: no %s series", tt.path, series)
+		}
+	}
+}
+
+// closeStore records that the server closed it.
+type closeStore struct {
+	store.Store
+	closed atomic.Bool
+}
+
+func (s *closeStore) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func TestServeDrainsOnShutdown(t *testing.T) {
+	delay := config.Envs.ShutdownDelay
+	config.Envs.ShutdownDelay = 0
+	defer func() { config.Envs.ShutdownDelay = delay }()
+
+	st := &closeStore{}
+	server := NewAPIServer(":0", st, 0)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- server.serve(ctx, ln, handler) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	inFlight := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			inFlight <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		inFlight <- result{string(body), err}
+	}()
+	<-started
+
+	// the signal
+	cancel()
+
+	// new connections are refused while the request is still running
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("still accepting connections after shutdown began")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-served:
+		t.Fatalf("serve returned %v before the in-flight request finished", err)
+	default:
+	}
+	if st.closed.Load() {
+		t.Fatal("store closed before the in-flight request finished")
+	}
+
+	close(release)
+	if r := <-inFlight; r.err != nil || r.body != "done" {
+		t.Errorf("in-flight request got %q, %v", r.body, r.err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("serve returned %v", err)
+	}
+	if !st.closed.Load() {
+		t.Error("store was not closed")
+	}
+}
@@ -0,0 +1,128 @@
+package api
+
+import (
+	"strings"
+	"time"
+
+	"github.com/AriJaya07/go-rest-api/packages/config"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/projects"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/tasks"
+	"github.com/AriJaya07/go-rest-api/packages/controllers/users"
+	"github.com/AriJaya07/go-rest-api/packages/middleware"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// apiPrefix is where every version is mounted, as apiPrefix/<name>.
+	apiPrefix = "/api"
+	// apiMediaType lets clients ask for a version in Accept, e.g.
+	// application/vnd.go-rest-api.v2+json.
+	apiMediaType = "application/vnd.go-rest-api"
+)
+
+// apiVersion is one version of the API. Versions are mounted side by side
+// until they are removed from apiVersions.
+type apiVersion struct {
+	name     string
+	register func(r *mux.Router)
+	// successors maps the version's deprecated routes, as "METHOD
+	// /template" below the version prefix, to the template of the route
+	// replacing each one, or "" when its URL cannot be derived from the
+	// request.
+	successors map[string]string
+	deprecated time.Time
+	sunset     time.Time
+	// credentials lists the routes that take passwords or start a sign-in,
+	// as "[METHOD ]/path" below the version prefix. They share the
+	// stricter auth rate limit. Unversioned requests are rewritten to a
+	// version before they are limited, so they are counted here too.
+	credentials []string
+}
+
+// v1Successors lists the v1 routes that have a v2 equivalent. Signing in,
+// two-factor authentication and OpenID Connect only exist in v1.
+var v1Successors = map[string]string{
+	"GET /projects":                    "/api/v2/projects",
+	"POST /projects/add":               "/api/v2/projects",
+	"GET /projects/detail/{id}":        "/api/v2/projects/{id}",
+	"PUT /projects/edit-projects/{id}": "/api/v2/projects/{id}",
+	"DELETE /projects/delete/{id}":     "/api/v2/projects/{id}",
+	"GET /users":                       "/api/v2/users",
+	"POST /users/register":             "/api/v2/users",
+	"PUT /users/edit-profile/{id}":     "/api/v2/users/{id}",
+	"DELETE /users/delete/{id}":        "/api/v2/users/{id}",
+	"PUT /users/change-password/{id}":  "/api/v2/users/{id}/password",
+	// v2 tasks live under their project, which v1 URLs do not name
+	"POST /tasks":      "",
+	"GET /tasks/${id}": "",
+}
+
+// apiVersions returns every mounted version, oldest first.
+func (s *APIServer) apiVersions() []apiVersion {
+	projectService := projects.NewProjectService(s.store)
+	usersService := users.NewUserService(s.store)
+	tasksService := tasks.NewTasksService(s.store)
+
+	return []apiVersion{
+		{
+			name: "v1",
+			register: func(r *mux.Router) {
+				projectService.RegisterRoutes(r)
+				usersService.RegisterRoutes(r)
+				tasksService.RegisterRoutes(r)
+			},
+			successors: v1Successors,
+			deprecated: config.Envs.APIV1DeprecatedAt,
+			sunset:     config.Envs.APIV1Sunset,
+			credentials: []string{
+				"/users/login",
+				"/users/login/2fa",
+				"/users/register",
+				"/users/oidc/login",
+			},
+		},
+		{
+			name: "v2",
+			register: func(r *mux.Router) {
+				projectService.RegisterRoutesV2(r)
+				usersService.RegisterRoutesV2(r)
+				tasksService.RegisterRoutesV2(r)
+			},
+			// registering shares its path with listing users
+			credentials: []string{"POST /users"},
+		},
+	}
+}
+
+func (v apiVersion) prefix() string {
+	return apiPrefix + "/" + v.name
+}
+
+// credentialRoutes returns the version's credential routes with the
+// version prefix, as middleware.RateLimiter.AddGroup expects.
+func (v apiVersion) credentialRoutes() []string {
+	routes := make([]string, len(v.credentials))
+	for i, route := range v.credentials {
+		if method, path, ok := strings.Cut(route, " "); ok {
+			routes[i] = method + " " + v.prefix() + path
+		} else {
+			routes[i] = v.prefix() + route
+		}
+	}
+	return routes
+}
+
+// deprecations keys the version's deprecated routes by full template, as
+// middleware.Deprecated expects.
+func (v apiVersion) deprecations() map[string]middleware.Deprecation {
+	routes := map[string]middleware.Deprecation{}
+	for route, successor := range v.successors {
+		method, path, _ := strings.Cut(route, " ")
+		routes[method+" "+v.prefix()+path] = middleware.Deprecation{
+			Since:     v.deprecated,
+			Sunset:    v.sunset,
+			Successor: successor,
+		}
+	}
+	return routes
+}
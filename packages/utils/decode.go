@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/config"
+)
+
+// DecodeJSON reads a single JSON value from the request body into dst. The
+// body must be application/json, no larger than config.Envs.MaxBodyBytes and
+// must not contain fields dst does not declare or anything after the value.
+// The returned error is an *apierror.Error describing what is wrong and,
+// where it can, which field and byte offset.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	if err := requireJSON(r); err != nil {
+		return err
+	}
+
+	return decodeBody(w, r, dst, true)
+}
+
+// decodeBody does the work of DecodeJSON once the media type is known.
+// Unless strict, fields dst does not declare are ignored.
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any, strict bool) error {
+	r.Body = http.MaxBytesReader(w, r.Body, config.Envs.MaxBodyBytes)
+	defer r.Body.Close()
+
+	dec := json.NewDecoder(r.Body)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+
+	// a second value, or anything but whitespace, after the first
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return decodeError(err)
+		}
+		return apierror.BadRequest("invalid_json", fmt.Sprintf("Request body must contain a single JSON value (unexpected data at offset %d)", dec.InputOffset()))
+	}
+
+	return nil
+}
+
+func requireJSON(r *http.Request) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		return apierror.New(apierror.KindUnsupportedMediaType, apierror.CodeUnsupportedMediaType, "Content-Type must be application/json")
+	}
+	return nil
+}
+
+func decodeError(err error) error {
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+		maxErr    *http.MaxBytesError
+	)
+
+	switch {
+	case errors.As(err, &maxErr):
+		return apierror.New(apierror.KindPayloadTooLarge, apierror.CodePayloadTooLarge, fmt.Sprintf("Request body must not be larger than %d bytes", maxErr.Limit))
+	case errors.As(err, &syntaxErr):
+		return apierror.BadRequest("invalid_json", fmt.Sprintf("Request body contains malformed JSON at offset %d: %s", syntaxErr.Offset, strings.TrimPrefix(syntaxErr.Error(), "json: ")))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return apierror.BadRequest("invalid_json", "Request body contains truncated JSON")
+	case errors.Is(err, io.EOF):
+		return apierror.BadRequest("empty_body", "Request body must not be empty")
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return apierror.BadRequest("invalid_json", fmt.Sprintf("Request body must be %s, not %s", jsonType(typeErr.Type.String()), typeErr.Value))
+		}
+		return fieldError("invalid_field_type", typeErr.Field,
+			fmt.Sprintf("must be %s, not %s", jsonType(typeErr.Type.String()), typeErr.Value),
+			fmt.Sprintf("Field %q has the wrong type at offset %d", typeErr.Field, typeErr.Offset))
+	}
+
+	// encoding/json has no type for this one
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		return fieldError("unknown_field", field, "is not a recognised field", fmt.Sprintf("Field %q is not recognised", field))
+	}
+
+	return apierror.BadRequest("invalid_json", "Request body could not be decoded").Wrap(err)
+}
+
+func fieldError(code, field, msg, detail string) error {
+	return &apierror.Error{
+		Kind:   apierror.KindBadRequest,
+		Code:   code,
+		Detail: detail,
+		Fields: map[string][]string{field: {msg}},
+	}
+}
+
+// jsonType names a Go type the way a client sending JSON would think of it.
+func jsonType(goType string) string {
+	switch {
+	case goType == "string":
+		return "a string"
+	case goType == "bool":
+		return "a boolean"
+	case strings.HasPrefix(goType, "int"), strings.HasPrefix(goType, "uint"):
+		return "an integer"
+	case strings.HasPrefix(goType, "float"):
+		return "a number"
+	case strings.HasPrefix(goType, "[]"):
+		return "an array"
+	}
+	return "an object"
+}
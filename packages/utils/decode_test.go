@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/config"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	defer func(n int64) { config.Envs.MaxBodyBytes = n }(config.Envs.MaxBodyBytes)
+	config.Envs.MaxBodyBytes = 64
+
+	type payload struct {
+		Name  string `json:"name"`
+		Count int    `json:"count"`
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		code        string
+		fields      map[string][]string
+	}{
+		{name: "valid", contentType: "application/json; charset=utf-8", body: `{"name":"a","count":1}` + "\n"},
+		{name: "no content type", body: `{}`, status: http.StatusUnsupportedMediaType, code: apierror.CodeUnsupportedMediaType},
+		{name: "wrong content type", contentType: "text/plain", body: `{}`, status: http.StatusUnsupportedMediaType, code: apierror.CodeUnsupportedMediaType},
+		{name: "too large", body: `{"name":"` + strings.Repeat("a", 100) + `"}`, status: http.StatusRequestEntityTooLarge, code: apierror.CodePayloadTooLarge},
+		{name: "empty", body: ``, status: http.StatusBadRequest, code: "empty_body"},
+		{name: "malformed", body: `{"name":}`, status: http.StatusBadRequest, code: "invalid_json"},
+		{name: "truncated", body: `{"name":"a"`, status: http.StatusBadRequest, code: "invalid_json"},
+		{name: "unknown field", body: `{"nmae":"a"}`, status: http.StatusBadRequest, code: "unknown_field",
+			fields: map[string][]string{"nmae": {"is not a recognised field"}}},
+		{name: "wrong type", body: `{"count":"1"}`, status: http.StatusBadRequest, code: "invalid_field_type",
+			fields: map[string][]string{"count": {"must be an integer, not string"}}},
+		{name: "not an object", body: `[]`, status: http.StatusBadRequest, code: "invalid_json"},
+		{name: "trailing value", body: `{"name":"a"}{"name":"b"}`, status: http.StatusBadRequest, code: "invalid_json"},
+		{name: "trailing garbage", body: `{"name":"a"} x`, status: http.StatusBadRequest, code: "invalid_json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			} else if tt.code != apierror.CodeUnsupportedMediaType {
+				r.Header.Set("Content-Type", "application/json")
+			}
+
+			var dst payload
+			err := DecodeJSON(httptest.NewRecorder(), r, &dst)
+
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if dst != (payload{Name: "a", Count: 1}) {
+					t.Errorf("decoded %+v", dst)
+				}
+				return
+			}
+
+			e := apierror.From(err)
+			if e.Status() != tt.status || e.Code != tt.code {
+				t.Fatalf("got %d %q (%s), want %d %q", e.Status(), e.Code, e.Detail, tt.status, tt.code)
+			}
+			if tt.fields != nil && !reflect.DeepEqual(e.Fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", e.Fields, tt.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+)
+
+// ETag is the entity tag of a resource at version. The Compress middleware
+// appends the content-coding to it for compressed responses and strips it
+// from conditional request headers, so handlers only deal in versions.
+func ETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// WriteVersioned responds 200 with v and its ETag, or 304 Not Modified when
+// a GET's If-None-Match already names the version.
+func WriteVersioned(w http.ResponseWriter, r *http.Request, version int64, v any) {
+	etag := ETag(version)
+	w.Header().Set("ETag", etag)
+
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		if header := r.Header.Get("If-None-Match"); header != "" && matchETag(header, etag, true) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	WriteJSON(w, http.StatusOK, v)
+}
+
+// CheckIfMatch returns a 412 when the request carries an If-Match header
+// that does not name the resource's current version. Requests without one
+// are let through.
+func CheckIfMatch(r *http.Request, version int64) error {
+	header := r.Header.Get("If-Match")
+	if header == "" || matchETag(header, ETag(version), false) {
+		return nil
+	}
+	return apierror.PreconditionFailed("Resource has changed since it was read; fetch it again and retry")
+}
+
+// matchETag reports whether the comma-separated tags in header include etag
+// or "*". Weak comparison, as If-None-Match uses, ignores the W/ prefix;
+// strong comparison, as If-Match uses, never matches a weak tag.
+func matchETag(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
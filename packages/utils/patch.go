@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+	"github.com/AriJaya07/go-rest-api/packages/patch"
+	"github.com/AriJaya07/go-rest-api/packages/validation"
+)
+
+// AcceptPatch lists the patch formats DecodePatch reads, for the
+// Accept-Patch header (RFC 5789).
+const AcceptPatch = patch.MergePatchType + ", " + patch.JSONPatchType
+
+// DecodePatch applies the patch in the request body to the JSON form of v,
+// the stored resource. The body may be a JSON Merge Patch, sent as
+// application/merge-patch+json or application/json, or a JSON Patch, sent
+// as application/json-patch+json, and is read with the same limits as
+// DecodeJSON. The members named in readOnly must come out unchanged. v is
+// only replaced once the result decodes cleanly; it still has to be
+// validated before it is saved.
+func DecodePatch[T any](w http.ResponseWriter, r *http.Request, v *T, readOnly ...string) error {
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return apierror.Internal(err)
+	}
+
+	var patched []byte
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case patch.MergePatchType, "application/json":
+		var p json.RawMessage
+		if err := decodeBody(w, r, &p, true); err != nil {
+			return err
+		}
+		if p[0] != '{' {
+			return apierror.BadRequest("invalid_patch", "Merge patch must be a JSON object")
+		}
+		patched, err = patch.Merge(doc, p)
+	case patch.JSONPatchType:
+		// RFC 6902 section 4: members an operation does not define are
+		// ignored
+		var ops []patch.Operation
+		if err := decodeBody(w, r, &ops, false); err != nil {
+			return err
+		}
+		patched, err = patch.Apply(doc, ops)
+	default:
+		w.Header().Set("Accept-Patch", AcceptPatch)
+		return apierror.New(apierror.KindUnsupportedMediaType, apierror.CodeUnsupportedMediaType,
+			"Content-Type must be "+patch.MergePatchType+" or "+patch.JSONPatchType)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := checkReadOnly(doc, patched, readOnly); err != nil {
+		return err
+	}
+
+	var out T
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&out); err != nil {
+		return decodeError(err)
+	}
+
+	*v = out
+	return nil
+}
+
+// checkReadOnly reports the members in names that differ between the
+// documents before and after patching.
+func checkReadOnly(before, after []byte, names []string) error {
+	var old, patched map[string]json.RawMessage
+	if err := json.Unmarshal(before, &old); err != nil {
+		return apierror.Internal(err)
+	}
+	if err := json.Unmarshal(after, &patched); err != nil {
+		return apierror.BadRequest("invalid_patch", "Patch must leave the resource a JSON object")
+	}
+
+	errs := validation.Errors{}
+	for _, name := range names {
+		if !bytes.Equal(old[name], patched[name]) {
+			errs.Add(name, "is read-only")
+		}
+	}
+	return errs.Err()
+}
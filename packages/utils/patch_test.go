@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+)
+
+func TestDecodePatch(t *testing.T) {
+	type resource struct {
+		ID    int64  `json:"id"`
+		Name  string `json:"name"`
+		Notes string `json:"notes"`
+	}
+	stored := resource{ID: 7, Name: "old", Notes: "keep"}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        resource
+		status      int
+		code        string
+		fields      map[string][]string
+	}{
+		{name: "merge patch", contentType: "application/merge-patch+json", body: `{"name":"new"}`,
+			want: resource{ID: 7, Name: "new", Notes: "keep"}},
+		{name: "plain JSON is a merge patch", contentType: "application/json", body: `{"notes":""}`,
+			want: resource{ID: 7, Name: "old"}},
+		{name: "merge null clears", contentType: "application/merge-patch+json", body: `{"notes":null}`,
+			want: resource{ID: 7, Name: "old"}},
+		{name: "read-only unchanged", contentType: "application/merge-patch+json", body: `{"id":7,"name":"new"}`,
+			want: resource{ID: 7, Name: "new", Notes: "keep"}},
+		{name: "JSON patch", contentType: "application/json-patch+json",
+			body: `[{"op":"test","path":"/name","value":"old"},{"op":"replace","path":"/name","value":"new"},{"op":"remove","path":"/notes"}]`,
+			want: resource{ID: 7, Name: "new"}},
+		{name: "JSON patch ignores unknown members", contentType: "application/json-patch+json",
+			body: `[{"op":"replace","path":"/name","value":"new","comment":"rename"}]`,
+			want: resource{ID: 7, Name: "new", Notes: "keep"}},
+
+		{name: "read-only changed", contentType: "application/merge-patch+json", body: `{"id":8}`,
+			status: http.StatusUnprocessableEntity, code: apierror.CodeValidation, fields: map[string][]string{"id": {"is read-only"}}},
+		{name: "read-only removed", contentType: "application/json-patch+json", body: `[{"op":"remove","path":"/id"}]`,
+			status: http.StatusUnprocessableEntity, code: apierror.CodeValidation, fields: map[string][]string{"id": {"is read-only"}}},
+		{name: "unknown field", contentType: "application/merge-patch+json", body: `{"nmae":"new"}`,
+			status: http.StatusBadRequest, code: "unknown_field"},
+		{name: "wrong type", contentType: "application/merge-patch+json", body: `{"name":5}`,
+			status: http.StatusBadRequest, code: "invalid_field_type"},
+		{name: "merge patch not an object", contentType: "application/merge-patch+json", body: `["name"]`,
+			status: http.StatusBadRequest, code: "invalid_patch"},
+		{name: "failed test", contentType: "application/json-patch+json", body: `[{"op":"test","path":"/name","value":"other"}]`,
+			status: http.StatusConflict, code: "patch_test_failed"},
+		{name: "JSON patch with trailing data", contentType: "application/json-patch+json", body: `[] []`,
+			status: http.StatusBadRequest, code: "invalid_json"},
+		{name: "malformed", contentType: "application/json-patch+json", body: `[{"op":`,
+			status: http.StatusBadRequest, code: "invalid_json"},
+		{name: "unsupported type", contentType: "text/plain", body: `{}`,
+			status: http.StatusUnsupportedMediaType, code: apierror.CodeUnsupportedMediaType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			got := stored
+			err := DecodePatch(w, r, &got, "id")
+
+			if tt.status == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("got %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+
+			e := apierror.From(err)
+			if e.Status() != tt.status || e.Code != tt.code {
+				t.Fatalf("got %d %q (%s), want %d %q", e.Status(), e.Code, e.Detail, tt.status, tt.code)
+			}
+			if tt.fields != nil && !reflect.DeepEqual(e.Fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", e.Fields, tt.fields)
+			}
+			if got != stored {
+				t.Errorf("failed patch changed the resource to %+v", got)
+			}
+			if tt.status == http.StatusUnsupportedMediaType && w.Header().Get("Accept-Patch") != AcceptPatch {
+				t.Errorf("Accept-Patch = %q", w.Header().Get("Accept-Patch"))
+			}
+		})
+	}
+}
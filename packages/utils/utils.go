@@ -3,6 +3,8 @@ package utils
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
 func WriteJSON(w http.ResponseWriter, status int, v any) {
@@ -10,3 +12,10 @@ func WriteJSON(w http.ResponseWriter, status int, v any) {
 	w.WriteHeader(status)
 	json.NewEncoder(w).Encode(v)
 }
+
+// WriteCreated responds 201 with v and a Location header pointing at id
+// under the collection the request was posted to.
+func WriteCreated(w http.ResponseWriter, r *http.Request, id int64, v any) {
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+strconv.FormatInt(id, 10))
+	WriteJSON(w, http.StatusCreated, v)
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+)
+
+func TestWriteCreated(t *testing.T) {
+	for _, path := range []string{"/api/v2/projects/3/tasks", "/api/v2/projects/3/tasks/"} {
+		rec := httptest.NewRecorder()
+		WriteCreated(rec, httptest.NewRequest(http.MethodPost, path, nil), 42, map[string]int{"id": 42})
+
+		if rec.Code != http.StatusCreated {
+			t.Errorf("%s: status = %d", path, rec.Code)
+		}
+		if loc := rec.Header().Get("Location"); loc != "/api/v2/projects/3/tasks/42" {
+			t.Errorf("%s: Location = %q", path, loc)
+		}
+	}
+}
+
+func TestWriteVersioned(t *testing.T) {
+	tests := []struct {
+		method      string
+		ifNoneMatch string
+		status      int
+	}{
+		{http.MethodGet, "", http.StatusOK},
+		{http.MethodGet, `"3"`, http.StatusNotModified},
+		{http.MethodGet, `W/"3"`, http.StatusNotModified},
+		{http.MethodGet, `"1", "3"`, http.StatusNotModified},
+		{http.MethodGet, `*`, http.StatusNotModified},
+		{http.MethodGet, `"2"`, http.StatusOK},
+		// only reads are answered from the client's copy
+		{http.MethodPatch, `"3"`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/v2/projects/1", nil)
+		if tt.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", tt.ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		WriteVersioned(rec, r, 3, map[string]int{"version": 3})
+
+		if rec.Code != tt.status {
+			t.Errorf("%s If-None-Match %s: status = %d, want %d", tt.method, tt.ifNoneMatch, rec.Code, tt.status)
+		}
+		if etag := rec.Header().Get("ETag"); etag != `"3"` {
+			t.Errorf("%s If-None-Match %s: ETag = %q", tt.method, tt.ifNoneMatch, etag)
+		}
+		if tt.status == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("%s If-None-Match %s: 304 has a body", tt.method, tt.ifNoneMatch)
+		}
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	tests := map[string]bool{
+		``:         true,
+		`"3"`:      true,
+		`"2", "3"`: true,
+		`*`:        true,
+		`"2"`:      false,
+		// If-Match compares strongly
+		`W/"3"`: false,
+	}
+
+	for ifMatch, ok := range tests {
+		r := httptest.NewRequest(http.MethodPut, "/api/v2/users/1", nil)
+		if ifMatch != "" {
+			r.Header.Set("If-Match", ifMatch)
+		}
+
+		err := CheckIfMatch(r, 3)
+		if ok && err != nil {
+			t.Errorf("If-Match %s: unexpected error %v", ifMatch, err)
+		}
+		if !ok && apierror.From(err).Status() != http.StatusPreconditionFailed {
+			t.Errorf("If-Match %s: got %v, want 412", ifMatch, err)
+		}
+	}
+}
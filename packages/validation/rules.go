@@ -0,0 +1,92 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var builtins = map[string]Rule{
+	"required": required,
+	"email":    email,
+	"min":      minRule,
+	"max":      maxRule,
+	"oneof":    oneOf,
+}
+
+func required(_ context.Context, v reflect.Value, _ string) (string, error) {
+	if v.IsZero() {
+		return "is required", nil
+	}
+	return "", nil
+}
+
+func email(_ context.Context, v reflect.Value, _ string) (string, error) {
+	s := v.String()
+	// reject display names such as "Ann <ann@example.com>"
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return "must be a valid email address", nil
+	}
+	return "", nil
+}
+
+// minRule and maxRule bound the length of strings and slices and the value
+// of numbers.
+func minRule(_ context.Context, v reflect.Value, param string) (string, error) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return "", fmt.Errorf("validation: bad min %q", param)
+	}
+
+	if size, unit := measure(v); size < n {
+		return strings.TrimSpace("must be at least " + param + " " + unit), nil
+	}
+	return "", nil
+}
+
+func maxRule(_ context.Context, v reflect.Value, param string) (string, error) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return "", fmt.Errorf("validation: bad max %q", param)
+	}
+
+	if size, unit := measure(v); size > n {
+		return strings.TrimSpace("must be at most " + param + " " + unit), nil
+	}
+	return "", nil
+}
+
+// measure returns the character count of a string, the length of a slice
+// or map, or the value of a number, along with the unit to report.
+func measure(v reflect.Value) (float64, string) {
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), "characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return float64(v.Len()), "items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), ""
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), ""
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), ""
+	}
+	return 0, ""
+}
+
+// oneOf takes space separated choices: oneof=TODO DONE.
+func oneOf(_ context.Context, v reflect.Value, param string) (string, error) {
+	choices := strings.Fields(param)
+	s := fmt.Sprint(v.Interface())
+	for _, c := range choices {
+		if s == c {
+			return "", nil
+		}
+	}
+	return "must be one of: " + strings.Join(choices, ", "), nil
+}
@@ -0,0 +1,158 @@
+// Package validation checks request payloads against rules declared in
+// `validate` struct tags and reports every failing field at once.
+//
+//	type Project struct {
+//		Name string `json:"name" validate:"required,max=255"`
+//	}
+//
+// Rules run in order and stop at the first failure for a field. omitempty
+// skips the remaining rules when the field is empty.
+package validation
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+)
+
+// Rule checks one field. It returns a message for the client when the
+// value is invalid, or an error when the check itself failed.
+type Rule func(ctx context.Context, value reflect.Value, param string) (string, error)
+
+// Errors maps JSON field names to what is wrong with them.
+type Errors map[string][]string
+
+func (e Errors) Add(field, msg string) {
+	e[field] = append(e[field], msg)
+}
+
+// Err returns a 422 validation error, or nil when there are no errors.
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return apierror.Validation("Request validation failed", e)
+}
+
+type Validator struct {
+	mu    sync.RWMutex
+	rules map[string]Rule
+}
+
+// New returns a validator with the built-in rules: required, email, min,
+// max and oneof.
+func New() *Validator {
+	v := &Validator{rules: map[string]Rule{}}
+	for name, rule := range builtins {
+		v.rules[name] = rule
+	}
+	return v
+}
+
+// Register adds or replaces a rule.
+func (v *Validator) Register(name string, rule Rule) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rules[name] = rule
+}
+
+var defaultValidator = New()
+
+// Struct validates s with the built-in rules only.
+func Struct(ctx context.Context, s any) error {
+	return defaultValidator.Struct(ctx, s)
+}
+
+// Check validates s with the built-in rules only.
+func Check(ctx context.Context, s any) (Errors, error) {
+	return defaultValidator.Check(ctx, s)
+}
+
+// Struct validates s and returns a 422 *apierror.Error listing every
+// invalid field, or the first error a rule failed with.
+func (v *Validator) Struct(ctx context.Context, s any) error {
+	errs, err := v.Check(ctx, s)
+	if err != nil {
+		return err
+	}
+	return errs.Err()
+}
+
+// Check is like Struct but returns the field errors so callers can add
+// their own before responding.
+func (v *Validator) Check(ctx context.Context, s any) (Errors, error) {
+	errs := Errors{}
+
+	rv := reflect.ValueOf(s)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			// a JSON body of null decodes to a nil pointer
+			errs.Add("body", "is required")
+			return errs, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("validation: %T is not a struct", s)
+	}
+
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || !field.IsExported() {
+			continue
+		}
+
+		msg, err := v.checkField(ctx, rv.Field(i), tag)
+		if err != nil {
+			return nil, err
+		}
+		if msg != "" {
+			errs.Add(jsonName(field), msg)
+		}
+	}
+
+	return errs, nil
+}
+
+func (v *Validator) checkField(ctx context.Context, value reflect.Value, tag string) (string, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	for _, spec := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(spec, "=")
+
+		if name == "omitempty" {
+			if value.IsZero() {
+				return "", nil
+			}
+			continue
+		}
+
+		rule, ok := v.rules[name]
+		if !ok {
+			return "", fmt.Errorf("validation: unknown rule %q", name)
+		}
+
+		msg, err := rule(ctx, value, param)
+		if err != nil || msg != "" {
+			return msg, err
+		}
+	}
+
+	return "", nil
+}
+
+// jsonName reports a field the way clients see it.
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
@@ -0,0 +1,83 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AriJaya07/go-rest-api/packages/apierror"
+)
+
+type payload struct {
+	Email  string `json:"email" validate:"required,email,max=20"`
+	Name   string `json:"name" validate:"omitempty,min=2,max=5"`
+	Count  int    `json:"count" validate:"min=1"`
+	Status string `json:"status" validate:"omitempty,oneof=TODO DONE"`
+	Owner  int64  `json:"owner" validate:"exists"`
+}
+
+func TestCheckCollectsAllFieldErrors(t *testing.T) {
+	v := New()
+	v.Register("exists", func(_ context.Context, value reflect.Value, _ string) (string, error) {
+		if value.Int() != 1 {
+			return "does not exist", nil
+		}
+		return "", nil
+	})
+
+	errs, err := v.Check(context.Background(), &payload{
+		Email:  "Ann <ann@example.com>",
+		Name:   "abcdefg",
+		Status: "DOING",
+		Owner:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Errors{
+		"email":  {"must be a valid email address"},
+		"name":   {"must be at most 5 characters"},
+		"count":  {"must be at least 1"},
+		"status": {"must be one of: TODO, DONE"},
+		"owner":  {"does not exist"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Errorf("got %v, want %v", errs, want)
+	}
+
+	var apiErr *apierror.Error
+	if !errors.As(errs.Err(), &apiErr) || apiErr.Status() != 422 {
+		t.Errorf("Err() = %v, want a 422", errs.Err())
+	}
+}
+
+func TestCheckValidPayload(t *testing.T) {
+	v := New()
+	v.Register("exists", func(context.Context, reflect.Value, string) (string, error) { return "", nil })
+
+	err := v.Struct(context.Background(), &payload{Email: "ann@example.com", Count: 3, Owner: 1})
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRuleFailureIsReturned(t *testing.T) {
+	v := New()
+	v.Register("exists", func(context.Context, reflect.Value, string) (string, error) {
+		return "", errors.New("database is down")
+	})
+
+	err := v.Struct(context.Background(), &payload{Email: "ann@example.com", Count: 1})
+	if err == nil || !strings.Contains(err.Error(), "database is down") {
+		t.Errorf("got %v, want the rule's error", err)
+	}
+}
+
+func TestUnknownRule(t *testing.T) {
+	if err := Struct(context.Background(), &payload{Email: "ann@example.com", Count: 1}); err == nil {
+		t.Error("expected an error for the unregistered exists rule")
+	}
+}